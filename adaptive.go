@@ -0,0 +1,106 @@
+package fcm
+
+import (
+	"net/http"
+	"time"
+)
+
+const (
+	defaultAdaptiveIncrease = 1
+	defaultAdaptiveDecrease = 0.5
+)
+
+// AdaptiveRateConfig configures the adaptive rate limiter, see WithAdaptiveRateLimit.
+type AdaptiveRateConfig struct {
+	// InitialRate is the starting rate in requests per second.
+	InitialRate float64
+	// MinRate and MaxRate bound the rate. Default MinRate is 1, MaxRate is 10 times InitialRate.
+	MinRate float64
+	MaxRate float64
+	// Burst is the maximum number of requests sent at once. Default 1.
+	Burst int
+	// Increase is added to the rate after each successful request. Default 1 request per second.
+	Increase float64
+	// Decrease multiplies the rate after each throttled request. Default 0.5.
+	Decrease float64
+}
+
+// WithAdaptiveRateLimit paces requests like WithRateLimit but adjusts the rate by the server
+// feedback using additive increase, multiplicative decrease: the rate is multiplied by Decrease
+// when the server responds with 429, 503 or Unavailable result errors, and grows by Increase
+// with each successful request. It replaces WithRateLimit.
+func WithAdaptiveRateLimit(cfg AdaptiveRateConfig) Option {
+	return func(o *clientOptions) {
+		if cfg.MinRate <= 0 {
+			cfg.MinRate = 1
+		}
+		if cfg.InitialRate < cfg.MinRate {
+			cfg.InitialRate = cfg.MinRate
+		}
+		if cfg.MaxRate < cfg.InitialRate {
+			cfg.MaxRate = cfg.InitialRate * 10
+		}
+		if cfg.Increase <= 0 {
+			cfg.Increase = defaultAdaptiveIncrease
+		}
+		if cfg.Decrease <= 0 || cfg.Decrease >= 1 {
+			cfg.Decrease = defaultAdaptiveDecrease
+		}
+		o.adaptiveRate = &cfg
+	}
+}
+
+// RateLimit returns the current rate limit in requests per second, zero if the client has no limit.
+func (c *Client) RateLimit() float64 {
+	if c.limiter == nil {
+		return 0
+	}
+	c.limiter.mu.Lock()
+	defer c.limiter.mu.Unlock()
+	return c.limiter.rate
+}
+
+// adapt adjusts the rate of the limiter by the outcome of the request.
+func (l *rateLimiter) adapt(cfg *AdaptiveRateConfig, throttled bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Tokens accumulated at the old rate.
+	l.advance(time.Now())
+	if throttled {
+		l.rate *= cfg.Decrease
+		if l.rate < cfg.MinRate {
+			l.rate = cfg.MinRate
+		}
+	} else {
+		l.rate += cfg.Increase
+		if l.rate > cfg.MaxRate {
+			l.rate = cfg.MaxRate
+		}
+	}
+}
+
+// adaptRate reports the outcome of the request to the adaptive rate limiter, if any.
+// Failures which don't indicate overload, e.g. invalid messages, are ignored.
+func (c *Client) adaptRate(statusCode int, resp *HttpResponse) {
+	if c.adaptiveRate == nil {
+		return
+	}
+	switch {
+	case statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable:
+		c.limiter.adapt(c.adaptiveRate, true)
+	case statusCode == http.StatusOK:
+		c.limiter.adapt(c.adaptiveRate, resp != nil && throttledResults(resp))
+	}
+}
+
+// throttledResults checks if any message was rejected because the server is overloaded.
+// Rate limits of individual devices and topics don't count.
+func throttledResults(resp *HttpResponse) bool {
+	for i := range resp.Results {
+		if resp.Results[i].Error == ErrorUnavailable {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,218 @@
+package fcm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	// Environment variable with the path to the credentials JSON file.
+	credentialsEnvVar = "GOOGLE_APPLICATION_CREDENTIALS"
+	// Environment variable with the ID of the project.
+	projectEnvVar = "GOOGLE_CLOUD_PROJECT"
+	// Environment variable which overrides gcloud configuration directory.
+	cloudSDKConfigEnvVar = "CLOUDSDK_CONFIG"
+	// Environment variable which overrides the address of the metadata server.
+	metadataHostEnvVar = "GCE_METADATA_HOST"
+
+	// Default address of the GCE metadata server.
+	defaultMetadataHost = "169.254.169.254"
+
+	metadataTokenPath   = "/computeMetadata/v1/instance/service-accounts/default/token"
+	metadataProjectPath = "/computeMetadata/v1/project/project-id"
+
+	// Name of the credentials file created by "gcloud auth application-default login".
+	wellKnownCredentialsFile = "application_default_credentials.json"
+)
+
+// metadataConnection is used for requests to the metadata server. Unlike the client
+// connection it never goes through a proxy: the server is only reachable from the instance.
+var metadataConnection http.RoundTripper = &http.Transport{
+	Proxy: nil,
+	DialContext: (&net.Dialer{
+		Timeout: defaultConnectionTimeout,
+	}).DialContext,
+	ResponseHeaderTimeout: defaultResponseHeaderTimeout,
+	IdleConnTimeout:       90 * time.Second,
+}
+
+// defaultCredentials is the content of a credentials JSON file of either
+// service_account or authorized_user type.
+type defaultCredentials struct {
+	Type string `json:"type"`
+
+	// authorized_user fields.
+	ClientID       string `json:"client_id"`
+	ClientSecret   string `json:"client_secret"`
+	RefreshToken   string `json:"refresh_token"`
+	QuotaProjectID string `json:"quota_project_id"`
+}
+
+// NewClientFromDefaultCredentials returns an FCM client which uses FCM HTTP v1 API with
+// Application Default Credentials. The credentials are looked up in the following order:
+//  1. The JSON file named by the GOOGLE_APPLICATION_CREDENTIALS environment variable.
+//  2. The file created by "gcloud auth application-default login".
+//  3. The metadata server when running on Google Compute Engine, GKE, Cloud Run and alike.
+//
+// If projectID is empty, it's taken from the credentials file, the GOOGLE_CLOUD_PROJECT
+// environment variable or the metadata server.
+func NewClientFromDefaultCredentials(ctx context.Context, projectID string, opts ...Option) (*Client, error) {
+	c := newClient(opts)
+
+	if projectID == "" {
+		projectID = os.Getenv(projectEnvVar)
+	}
+
+	tokens, fileProjectID, err := defaultCredentialsFromFile(c.connection)
+	if err != nil {
+		return nil, err
+	}
+	if tokens == nil {
+		// No credentials file, try metadata server.
+		host := os.Getenv(metadataHostEnvVar)
+		if host == "" {
+			host = defaultMetadataHost
+		}
+		metadataProjectID, err := metadataGet(ctx, metadataConnection, host, metadataProjectPath)
+		if err != nil {
+			return nil, errors.New("fcm: default credentials not found: " + err.Error())
+		}
+		fileProjectID = metadataProjectID
+		tokens = &cachedTokens{fetch: (&metadataTokens{host: host, connection: metadataConnection}).fetch}
+	}
+
+	if projectID == "" {
+		projectID = fileProjectID
+	}
+	if projectID == "" {
+		return nil, errors.New("fcm: project ID is not specified")
+	}
+
+	c.projectID = projectID
+	c.tokens = tokens
+	c.start()
+	return c, nil
+}
+
+// defaultCredentialsFromFile loads credentials from the file named by the environment
+// variable or from the gcloud well-known file. It returns nil tokens if neither exists.
+func defaultCredentialsFromFile(connection http.RoundTripper) (TokenSource, string, error) {
+	path := os.Getenv(credentialsEnvVar)
+	if path == "" {
+		path = wellKnownCredentialsPath()
+		if _, err := os.Stat(path); err != nil {
+			return nil, "", nil
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var creds defaultCredentials
+	if err = json.Unmarshal(data, &creds); err != nil {
+		return nil, "", err
+	}
+
+	switch creds.Type {
+	case "service_account":
+		tokens, account, err := newServiceAccountTokens(data, connection)
+		if err != nil {
+			return nil, "", err
+		}
+		return tokens, account.ProjectID, nil
+	case "authorized_user":
+		if creds.RefreshToken == "" {
+			return nil, "", errors.New("fcm: refresh_token is missing in credentials file")
+		}
+		t := &authorizedUserTokens{
+			clientID:     creds.ClientID,
+			clientSecret: creds.ClientSecret,
+			refreshToken: creds.RefreshToken,
+			connection:   connection,
+		}
+		return &cachedTokens{fetch: t.fetch}, creds.QuotaProjectID, nil
+	}
+	return nil, "", errors.New("fcm: unsupported credentials type '" + creds.Type + "'")
+}
+
+// wellKnownCredentialsPath returns the path to the credentials file created by gcloud.
+func wellKnownCredentialsPath() string {
+	if dir := os.Getenv(cloudSDKConfigEnvVar); dir != "" {
+		return filepath.Join(dir, wellKnownCredentialsFile)
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("APPDATA"), "gcloud", wellKnownCredentialsFile)
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config", "gcloud", wellKnownCredentialsFile)
+}
+
+// authorizedUserTokens obtains access tokens for user credentials using the refresh token.
+type authorizedUserTokens struct {
+	clientID     string
+	clientSecret string
+	refreshToken string
+
+	connection http.RoundTripper
+}
+
+func (t *authorizedUserTokens) fetch(ctx context.Context) (*tokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("client_id", t.clientID)
+	form.Set("client_secret", t.clientSecret)
+	form.Set("refresh_token", t.refreshToken)
+
+	return postTokenForm(ctx, t.connection, googleTokenURL, form)
+}
+
+// metadataTokens obtains access tokens of the default service account from the metadata server.
+type metadataTokens struct {
+	host       string
+	connection http.RoundTripper
+}
+
+func (t *metadataTokens) fetch(ctx context.Context) (*tokenResponse, error) {
+	req, err := newMetadataRequest(ctx, t.host, metadataTokenPath+"?scopes="+url.QueryEscape(firebaseMessagingScope))
+	if err != nil {
+		return nil, err
+	}
+	return requestToken(t.connection, req)
+}
+
+func newMetadataRequest(ctx context.Context, host, path string) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, "http://"+host+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Add(http.CanonicalHeaderKey("Metadata-Flavor"), "Google")
+	return req, nil
+}
+
+// metadataGet reads a value from the metadata server.
+func metadataGet(ctx context.Context, connection http.RoundTripper, host, path string) (string, error) {
+	req, err := newMetadataRequest(ctx, host, path)
+	if err != nil {
+		return "", err
+	}
+	resp, body, err := roundTrip(connection, req)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New(resp.Status + ": " + string(body))
+	}
+	return strings.TrimSpace(string(body)), nil
+}
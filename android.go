@@ -0,0 +1,184 @@
+package fcm
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Values of AndroidConfig.Priority.
+const (
+	AndroidPriorityNormal = "NORMAL"
+	AndroidPriorityHigh   = "HIGH"
+)
+
+// Values of AndroidNotification.NotificationPriority.
+const (
+	AndroidNotificationPriorityMin     = "PRIORITY_MIN"
+	AndroidNotificationPriorityLow     = "PRIORITY_LOW"
+	AndroidNotificationPriorityDefault = "PRIORITY_DEFAULT"
+	AndroidNotificationPriorityHigh    = "PRIORITY_HIGH"
+	AndroidNotificationPriorityMax     = "PRIORITY_MAX"
+)
+
+// Values of AndroidNotification.Visibility.
+const (
+	AndroidVisibilityPrivate = "PRIVATE"
+	AndroidVisibilityPublic  = "PUBLIC"
+	AndroidVisibilitySecret  = "SECRET"
+)
+
+// AndroidConfig is Android-specific message options.
+type AndroidConfig struct {
+	CollapseKey string `json:"collapse_key,omitempty"`
+	// Priority is AndroidPriorityNormal or AndroidPriorityHigh.
+	Priority string `json:"priority,omitempty"`
+	// TTL is duration in seconds with up to nine fractional digits, terminated by 's', e.g. "3.5s".
+	// Use AndroidTTL to format it.
+	TTL                   string               `json:"ttl,omitempty"`
+	RestrictedPackageName string               `json:"restricted_package_name,omitempty"`
+	Data                  map[string]string    `json:"data,omitempty"`
+	Notification          *AndroidNotification `json:"notification,omitempty"`
+	FcmOptions            *FcmOptions          `json:"fcm_options,omitempty"`
+	// DirectBootOk allows delivering the message while the device is in direct boot mode.
+	DirectBootOk bool `json:"direct_boot_ok,omitempty"`
+}
+
+// AndroidNotification is notification to send to Android devices.
+type AndroidNotification struct {
+	Title        string   `json:"title,omitempty"`
+	Body         string   `json:"body,omitempty"`
+	Icon         string   `json:"icon,omitempty"`
+	Color        string   `json:"color,omitempty"`
+	Sound        string   `json:"sound,omitempty"`
+	Tag          string   `json:"tag,omitempty"`
+	ClickAction  string   `json:"click_action,omitempty"`
+	BodyLocKey   string   `json:"body_loc_key,omitempty"`
+	BodyLocArgs  []string `json:"body_loc_args,omitempty"`
+	TitleLocKey  string   `json:"title_loc_key,omitempty"`
+	TitleLocArgs []string `json:"title_loc_args,omitempty"`
+	ChannelId    string   `json:"channel_id,omitempty"`
+	Ticker       string   `json:"ticker,omitempty"`
+	Sticky       bool     `json:"sticky,omitempty"`
+	// EventTime is the time of the event in RFC3339 format, e.g. "2014-10-02T15:01:23.045123456Z".
+	EventTime string `json:"event_time,omitempty"`
+	LocalOnly bool   `json:"local_only,omitempty"`
+	// NotificationPriority is one of AndroidNotificationPriority* constants.
+	NotificationPriority  string `json:"notification_priority,omitempty"`
+	DefaultSound          bool   `json:"default_sound,omitempty"`
+	DefaultVibrateTimings bool   `json:"default_vibrate_timings,omitempty"`
+	DefaultLightSettings  bool   `json:"default_light_settings,omitempty"`
+	// VibrateTimings are durations in the same format as AndroidConfig.TTL.
+	VibrateTimings []string `json:"vibrate_timings,omitempty"`
+	// Visibility is one of AndroidVisibility* constants.
+	Visibility        string                `json:"visibility,omitempty"`
+	NotificationCount *int                  `json:"notification_count,omitempty"`
+	LightSettings     *AndroidLightSettings `json:"light_settings,omitempty"`
+	Image             string                `json:"image,omitempty"`
+}
+
+// AndroidLightSettings controls the notification LED.
+type AndroidLightSettings struct {
+	Color *AndroidColor `json:"color"`
+	// LightOnDuration and LightOffDuration are durations in the same format as AndroidConfig.TTL.
+	LightOnDuration  string `json:"light_on_duration"`
+	LightOffDuration string `json:"light_off_duration"`
+}
+
+// AndroidColor is a color in RGBA color space, components are between 0 and 1.
+type AndroidColor struct {
+	Red   float64  `json:"red"`
+	Green float64  `json:"green"`
+	Blue  float64  `json:"blue"`
+	Alpha *float64 `json:"alpha,omitempty"`
+}
+
+// AndroidTTL formats the duration as AndroidConfig.TTL.
+func AndroidTTL(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
+
+// NewAndroidConfig converts Android-related fields of the legacy message to AndroidConfig:
+// collapse key, priority, time to live, restricted package name, data and notification.
+// Data values which are not strings are encoded as JSON because HTTP v1 API accepts only
+// string values.
+func NewAndroidConfig(msg *HttpMessage) *AndroidConfig {
+	cfg := &AndroidConfig{
+		CollapseKey:           msg.CollapseKey,
+		RestrictedPackageName: msg.RestrictedPackageName,
+		Data:                  stringData(msg.Data),
+	}
+
+	switch msg.Priority {
+	case PriorityHigh:
+		cfg.Priority = AndroidPriorityHigh
+	case PriorityNormal:
+		cfg.Priority = AndroidPriorityNormal
+	}
+
+	if msg.TimeToLive != nil {
+		cfg.TTL = AndroidTTL(time.Duration(*msg.TimeToLive) * time.Second)
+	}
+
+	if n := msg.Notification; n != nil {
+		cfg.Notification = &AndroidNotification{
+			Title:        n.Title,
+			Body:         n.Body,
+			Icon:         n.Icon,
+			Color:        n.Color,
+			Sound:        n.Sound,
+			Tag:          n.Tag,
+			ClickAction:  n.ClickAction,
+			BodyLocKey:   n.BodyLocKey,
+			BodyLocArgs:  n.BodyLocArgs,
+			TitleLocKey:  n.TitleLocKey,
+			TitleLocArgs: n.TitleLocArgs,
+			ChannelId:    n.AndroidChannelId,
+			Image:        n.Image,
+		}
+	}
+
+	return cfg
+}
+
+// stringData converts the legacy message data payload to a map of strings.
+func stringData(data interface{}) map[string]string {
+	switch data := data.(type) {
+	case nil:
+		return nil
+	case map[string]string:
+		return data
+	case map[string]interface{}:
+		result := make(map[string]string, len(data))
+		for k, v := range data {
+			result[k] = stringValue(v)
+		}
+		return result
+	}
+
+	// Arbitrary struct: round trip through JSON.
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil
+	}
+	var fields map[string]interface{}
+	if json.Unmarshal(raw, &fields) != nil {
+		return nil
+	}
+	return stringData(fields)
+}
+
+func stringValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(raw)
+}
@@ -0,0 +1,241 @@
+package fcm
+
+import (
+	"encoding/json"
+)
+
+// APNs request headers, see
+// https://developer.apple.com/documentation/usernotifications/sending-notification-requests-to-apns
+const (
+	ApnsHeaderPriority   = "apns-priority"
+	ApnsHeaderCollapseId = "apns-collapse-id"
+	ApnsHeaderPushType   = "apns-push-type"
+	ApnsHeaderExpiration = "apns-expiration"
+	ApnsHeaderTopic      = "apns-topic"
+)
+
+// Values of the apns-push-type header.
+const (
+	ApnsPushTypeAlert        = "alert"
+	ApnsPushTypeBackground   = "background"
+	ApnsPushTypeVoip         = "voip"
+	ApnsPushTypeLocation     = "location"
+	ApnsPushTypeComplication = "complication"
+	ApnsPushTypeFileProvider = "fileprovider"
+	ApnsPushTypeMdm          = "mdm"
+)
+
+// Values of the apns-priority header.
+const (
+	// Send the notification immediately.
+	ApnsPriorityHigh = "10"
+	// Send the notification based on power considerations on the device.
+	ApnsPriorityNormal = "5"
+	// Prioritize the device's power over all other factors.
+	ApnsPriorityLow = "1"
+)
+
+// Values of Aps.InterruptionLevel.
+const (
+	ApnsInterruptionPassive       = "passive"
+	ApnsInterruptionActive        = "active"
+	ApnsInterruptionTimeSensitive = "time-sensitive"
+	ApnsInterruptionCritical      = "critical"
+)
+
+// ApnsConfig is Apple Push Notification Service specific options.
+type ApnsConfig struct {
+	// Headers are APNs request headers, such as ApnsHeaderPriority or ApnsHeaderCollapseId.
+	Headers    map[string]string `json:"headers,omitempty"`
+	Payload    *ApnsPayload      `json:"payload,omitempty"`
+	FcmOptions *ApnsFcmOptions   `json:"fcm_options,omitempty"`
+}
+
+// NewApnsConfig converts iOS-related fields of the legacy message to ApnsConfig: notification,
+// content available and mutable content flags and data. Data values are added to the payload next to 'aps'.
+func NewApnsConfig(msg *HttpMessage) *ApnsConfig {
+	aps := &Aps{}
+	if msg.ContentAvailable {
+		aps.ContentAvailable = 1
+	}
+	if msg.MutableContent {
+		aps.MutableContent = 1
+	}
+
+	cfg := &ApnsConfig{Payload: &ApnsPayload{Aps: aps}}
+	if n := msg.Notification; n != nil {
+		aps.Alert = &ApsAlert{
+			Title:        n.Title,
+			Subtitle:     n.Subtitle,
+			Body:         n.Body,
+			TitleLocKey:  n.TitleLocKey,
+			TitleLocArgs: n.TitleLocArgs,
+			LocKey:       n.BodyLocKey,
+			LocArgs:      n.BodyLocArgs,
+		}
+		aps.Sound = n.Sound
+		aps.Category = n.ClickAction
+		if n.Badge != nil {
+			badge := int(*n.Badge)
+			aps.Badge = &badge
+		}
+		if n.Image != "" {
+			cfg.FcmOptions = &ApnsFcmOptions{Image: n.Image}
+		}
+	}
+
+	if data := stringData(msg.Data); len(data) > 0 {
+		cfg.Payload.CustomData = make(map[string]interface{}, len(data))
+		for k, v := range data {
+			cfg.Payload.CustomData[k] = v
+		}
+	}
+
+	return cfg
+}
+
+// SetHeader sets the APNs request header.
+func (c *ApnsConfig) SetHeader(name, value string) {
+	if c.Headers == nil {
+		c.Headers = make(map[string]string)
+	}
+	c.Headers[name] = value
+}
+
+// ApnsFcmOptions is options for features provided by the FCM SDK for iOS.
+type ApnsFcmOptions struct {
+	AnalyticsLabel string `json:"analytics_label,omitempty"`
+	// Image is URL of an image to be displayed in the notification.
+	Image string `json:"image,omitempty"`
+}
+
+// ApnsPayload is APNs payload.
+type ApnsPayload struct {
+	Aps *Aps `json:"aps,omitempty"`
+	// CustomData are app-specific keys serialized next to 'aps' at the top level of the payload.
+	CustomData map[string]interface{} `json:"-"`
+}
+
+// MarshalJSON serializes the 'aps' dictionary together with the custom keys.
+func (p ApnsPayload) MarshalJSON() ([]byte, error) {
+	payload := make(map[string]interface{}, len(p.CustomData)+1)
+	for k, v := range p.CustomData {
+		payload[k] = v
+	}
+	if p.Aps != nil {
+		payload["aps"] = p.Aps
+	}
+	return json.Marshal(payload)
+}
+
+// UnmarshalJSON decodes the 'aps' dictionary and collects the other keys into CustomData.
+func (p *ApnsPayload) UnmarshalJSON(data []byte) error {
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+	p.Aps = nil
+	p.CustomData = nil
+	for k, v := range payload {
+		if k == "aps" {
+			if string(v) == "null" {
+				continue
+			}
+			p.Aps = &Aps{}
+			if err := json.Unmarshal(v, p.Aps); err != nil {
+				return err
+			}
+			continue
+		}
+		var value interface{}
+		if err := json.Unmarshal(v, &value); err != nil {
+			return err
+		}
+		if p.CustomData == nil {
+			p.CustomData = make(map[string]interface{})
+		}
+		p.CustomData[k] = value
+	}
+	return nil
+}
+
+// Aps is the 'aps' dictionary of the APNs payload.
+type Aps struct {
+	Alert *ApsAlert `json:"alert,omitempty"`
+	Badge *int      `json:"badge,omitempty"`
+	// Sound is the name of the sound file. Ignored if CriticalSound is set.
+	Sound string `json:"sound,omitempty"`
+	// CriticalSound is serialized as the 'sound' dictionary.
+	CriticalSound *CriticalSound `json:"-"`
+	// ContentAvailable set to 1 makes the notification a background update.
+	ContentAvailable int `json:"content-available,omitempty"`
+	// MutableContent set to 1 lets the Notification Service Extension modify the notification.
+	MutableContent int    `json:"mutable-content,omitempty"`
+	Category       string `json:"category,omitempty"`
+	ThreadId       string `json:"thread-id,omitempty"`
+	// TargetContentId is the identifier of the window brought forward.
+	TargetContentId string `json:"target-content-id,omitempty"`
+	// InterruptionLevel is one of ApnsInterruption* constants.
+	InterruptionLevel string `json:"interruption-level,omitempty"`
+	// RelevanceScore between 0 and 1 is used to sort notifications in the summary.
+	RelevanceScore *float64 `json:"relevance-score,omitempty"`
+	FilterCriteria string   `json:"filter-criteria,omitempty"`
+}
+
+// CriticalSound is the sound dictionary of the 'aps' payload.
+type CriticalSound struct {
+	// Critical set to 1 marks the notification as a critical alert.
+	Critical int    `json:"critical,omitempty"`
+	Name     string `json:"name"`
+	// Volume is between 0.0 (silent) and 1.0 (full volume).
+	Volume float64 `json:"volume,omitempty"`
+}
+
+// MarshalJSON serializes Aps using either Sound or CriticalSound as the 'sound' value.
+func (a Aps) MarshalJSON() ([]byte, error) {
+	type aps Aps
+	if a.CriticalSound == nil {
+		return json.Marshal(aps(a))
+	}
+	return json.Marshal(struct {
+		aps
+		Sound *CriticalSound `json:"sound"`
+	}{aps(a), a.CriticalSound})
+}
+
+// UnmarshalJSON decodes the 'sound' value into either Sound or CriticalSound.
+func (a *Aps) UnmarshalJSON(data []byte) error {
+	type aps Aps
+	v := struct {
+		*aps
+		Sound json.RawMessage `json:"sound"`
+	}{aps: (*aps)(a)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	a.Sound = ""
+	a.CriticalSound = nil
+	if len(v.Sound) == 0 || string(v.Sound) == "null" {
+		return nil
+	}
+	if v.Sound[0] == '{' {
+		a.CriticalSound = &CriticalSound{}
+		return json.Unmarshal(v.Sound, a.CriticalSound)
+	}
+	return json.Unmarshal(v.Sound, &a.Sound)
+}
+
+// ApsAlert is the alert dictionary of the 'aps' payload.
+type ApsAlert struct {
+	Title           string   `json:"title,omitempty"`
+	Subtitle        string   `json:"subtitle,omitempty"`
+	Body            string   `json:"body,omitempty"`
+	LaunchImage     string   `json:"launch-image,omitempty"`
+	TitleLocKey     string   `json:"title-loc-key,omitempty"`
+	TitleLocArgs    []string `json:"title-loc-args,omitempty"`
+	SubtitleLocKey  string   `json:"subtitle-loc-key,omitempty"`
+	SubtitleLocArgs []string `json:"subtitle-loc-args,omitempty"`
+	LocKey          string   `json:"loc-key,omitempty"`
+	LocArgs         []string `json:"loc-args,omitempty"`
+	ActionLocKey    string   `json:"action-loc-key,omitempty"`
+}
@@ -0,0 +1,78 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrQueueFull is returned by PostHttp when all workers are busy and the queue is full.
+var ErrQueueFull = errors.New("fcm: send queue is full")
+
+// PostResult is the outcome of a non-blocking PostHttp call.
+type PostResult struct {
+	Response *HttpResponse
+	Err      error
+}
+
+// postJob is a PostHttp request waiting for a worker.
+type postJob struct {
+	msg    *HttpMessage
+	result chan PostResult
+}
+
+// PostHttp is a non-blocking version of SendHttp. The message is sent on a separate
+// go routine using the connection pool of the client. The returned channel has capacity 1,
+// it receives exactly one PostResult once the send completes and then it's closed.
+// The returned error is non-nil only if the request could not be started, e.g. the
+// message is invalid or the queue is full (see WithAsyncWorkers).
+// Errors of the send itself are reported in PostResult.Err. The message is sent like with
+// SendHttp and must not be modified until the result is received.
+// Multiple PostHttp requests can be issued simultaneously on the same Client.
+func (c *Client) PostHttp(msg *HttpMessage) (<-chan PostResult, error) {
+	if err := c.checkMessage(msg); err != nil {
+		return nil, err
+	}
+	job := postJob{msg: msg, result: make(chan PostResult, 1)}
+
+	// The queue is closed by Close while holding the lock.
+	c.closeLock.RLock()
+	defer c.closeLock.RUnlock()
+	if c.closed {
+		return nil, ErrClientClosed
+	}
+	c.inflight.Add(1)
+
+	if c.postQueue == nil {
+		go c.runJob(job)
+		return job.result, nil
+	}
+
+	select {
+	case c.postQueue <- job:
+		return job.result, nil
+	default:
+		c.inflight.Done()
+		return nil, ErrQueueFull
+	}
+}
+
+// startWorkers starts the pool of go routines which serve PostHttp requests.
+func (c *Client) startWorkers(workers, queueSize int) {
+	c.postQueue = make(chan postJob, queueSize)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range c.postQueue {
+				c.runJob(job)
+			}
+		}()
+	}
+}
+
+func (c *Client) runJob(job postJob) {
+	defer c.endSend()
+
+	resp, err := c.deliver(context.Background(), job.msg, nil)
+	c.deadLetter(job.msg, err)
+	job.result <- PostResult{Response: resp, Err: err}
+	close(job.result)
+}
@@ -0,0 +1,41 @@
+package fcm
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPostHttpDedup(t *testing.T) {
+	for _, workers := range []int{0, 2} {
+		srv := newGateServer(t)
+		srv.open()
+		opts := []Option{WithBaseURL(srv.URL), WithDedup(time.Minute)}
+		if workers > 0 {
+			opts = append(opts, WithAsyncWorkers(workers, 10))
+		}
+		c := NewClient("key", opts...)
+
+		first, err := c.PostHttp(&HttpMessage{To: "a", IdempotencyKey: "k"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r := <-first; r.Err != nil {
+			t.Fatalf("workers %d: first PostHttp = %v", workers, r.Err)
+		}
+		second, err := c.PostHttp(&HttpMessage{To: "a", IdempotencyKey: "k"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r := <-second; r.Err != ErrDuplicate {
+			t.Errorf("workers %d: duplicate PostHttp = %v, want ErrDuplicate", workers, r.Err)
+		}
+
+		if err := c.Close(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if n := len(srv.waitReceived(t, 1)); n != 1 {
+			t.Errorf("workers %d: received %d messages, want 1", workers, n)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package fcm
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// OAuth2 scope required for sending messages through FCM HTTP v1 API.
+	firebaseMessagingScope = "https://www.googleapis.com/auth/firebase.messaging"
+
+	// Default Google OAuth2 token endpoint.
+	googleTokenURL = "https://oauth2.googleapis.com/token"
+
+	// Lifetime of the signed JWT assertion. Google does not accept more than one hour.
+	assertionLifetime = time.Hour
+
+	// Access token is refreshed this long before it actually expires.
+	tokenExpiryDelta = time.Minute
+)
+
+// TokenSource provides OAuth2 access tokens for the HTTP v1 API.
+type TokenSource interface {
+	// Token returns a valid access token. It's called before every request, so
+	// the implementation is expected to cache the token until it's about to expire.
+	// It must be safe for concurrent use.
+	Token(ctx context.Context) (string, error)
+}
+
+// NewServiceAccountTokenSource returns a TokenSource which mints access tokens from the service
+// account JSON key and caches them until they are about to expire. Transport options, such as
+// WithHTTPClient or WithRoundTripper, control how the tokens are requested.
+func NewServiceAccountTokenSource(serviceAccountJSON []byte, opts ...Option) (TokenSource, error) {
+	tokens, _, err := newServiceAccountTokens(serviceAccountJSON, applyOptions(opts).newConnection())
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// serviceAccount is the content of a service account JSON key file.
+type serviceAccount struct {
+	Type         string `json:"type"`
+	ProjectID    string `json:"project_id"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	ClientEmail  string `json:"client_email"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// tokenResponse is a response from the OAuth2 token endpoint.
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// cachedTokens caches access tokens obtained by fetch until they are about to expire.
+type cachedTokens struct {
+	fetch func(ctx context.Context) (*tokenResponse, error)
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// Token returns a valid access token, requesting a new one if the cached token is
+// missing or about to expire. Concurrent callers wait for the same refresh.
+func (t *cachedTokens) Token(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.token != "" && time.Now().Add(tokenExpiryDelta).Before(t.expiry) {
+		return t.token, nil
+	}
+
+	tr, err := t.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	t.token = tr.AccessToken
+	t.expiry = time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second)
+
+	return t.token, nil
+}
+
+// requestToken issues the request to a token endpoint and decodes the response.
+func requestToken(connection http.RoundTripper, req *http.Request) (*tokenResponse, error) {
+	resp, body, err := roundTrip(connection, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("fcm: failed to obtain access token: " + resp.Status + ": " + string(body))
+	}
+
+	var tr tokenResponse
+	if err = json.Unmarshal(body, &tr); err != nil {
+		return nil, err
+	}
+	if tr.AccessToken == "" {
+		return nil, errors.New("fcm: access token is missing in token response")
+	}
+	return &tr, nil
+}
+
+// postTokenForm requests a token from the OAuth2 token endpoint using the given grant.
+func postTokenForm(ctx context.Context, connection http.RoundTripper, tokenURL string,
+	form url.Values) (*tokenResponse, error) {
+
+	req, err := http.NewRequest(http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Add(http.CanonicalHeaderKey("Content-Type"), "application/x-www-form-urlencoded")
+
+	return requestToken(connection, req)
+}
+
+// serviceAccountTokens mints OAuth2 access tokens for a service account using JWT bearer grant.
+type serviceAccountTokens struct {
+	email    string
+	keyID    string
+	tokenURL string
+	key      *rsa.PrivateKey
+
+	connection http.RoundTripper
+}
+
+func newServiceAccountTokens(serviceAccountJSON []byte,
+	connection http.RoundTripper) (*cachedTokens, *serviceAccount, error) {
+
+	var account serviceAccount
+	if err := json.Unmarshal(serviceAccountJSON, &account); err != nil {
+		return nil, nil, err
+	}
+	if account.Type != "" && account.Type != "service_account" {
+		return nil, nil, errors.New("fcm: unsupported credentials type '" + account.Type + "'")
+	}
+	if account.ClientEmail == "" {
+		return nil, nil, errors.New("fcm: client_email is missing in service account key")
+	}
+
+	key, err := parsePrivateKey(account.PrivateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tokenURL := account.TokenURI
+	if tokenURL == "" {
+		tokenURL = googleTokenURL
+	}
+
+	t := &serviceAccountTokens{
+		email:      account.ClientEmail,
+		keyID:      account.PrivateKeyID,
+		tokenURL:   tokenURL,
+		key:        key,
+		connection: connection,
+	}
+	return &cachedTokens{fetch: t.fetch}, &account, nil
+}
+
+// parsePrivateKey parses PEM-encoded RSA private key in PKCS#8 or PKCS#1 form.
+func parsePrivateKey(pemKey string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(pemKey))
+	if block == nil {
+		return nil, errors.New("fcm: invalid private key in service account key")
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		if rsaKey, ok := key.(*rsa.PrivateKey); ok {
+			return rsaKey, nil
+		}
+		return nil, errors.New("fcm: private key is not an RSA key")
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+func (t *serviceAccountTokens) fetch(ctx context.Context) (*tokenResponse, error) {
+	assertion, err := t.assertion()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", assertion)
+
+	return postTokenForm(ctx, t.connection, t.tokenURL, form)
+}
+
+// assertion creates JWT signed with the service account private key.
+func (t *serviceAccountTokens) assertion() (string, error) {
+	header := map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+	}
+	if t.keyID != "" {
+		header["kid"] = t.keyID
+	}
+
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":   t.email,
+		"scope": firebaseMessagingScope,
+		"aud":   t.tokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(assertionLifetime).Unix(),
+	}
+
+	h, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, t.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
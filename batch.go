@@ -0,0 +1,187 @@
+package fcm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+const (
+	// FCM batch endpoint
+	batchPath = "/batch"
+
+	// MaxBatchSize is the maximum number of messages in one batch request.
+	MaxBatchSize = 500
+)
+
+// BatchResponse is the result of SendBatch.
+type BatchResponse struct {
+	SuccessCount int
+	FailureCount int
+	// Responses are in the same order as the messages: Responses[i] is the outcome of msgs[i].
+	Responses []BatchResult
+}
+
+// BatchResult is the outcome of sending one message of the batch.
+type BatchResult struct {
+	// Response is set if the message was sent successfully.
+	Response *V1Response
+	// Err is set if the message could not be sent, usually *V1Error.
+	Err error
+}
+
+// SendBatch sends up to MaxBatchSize HTTP v1 API messages packed into a single HTTP request.
+// The client must be created with NewClientV1. The returned error is non-nil only if the
+// batch as a whole failed, failures of individual messages are reported in BatchResponse.
+func (c *Client) SendBatch(msgs []*Message) (*BatchResponse, error) {
+	return c.SendBatchContext(context.Background(), msgs)
+}
+
+// SendBatchContext is the same as SendBatch but the request is bound to the given context.
+func (c *Client) SendBatchContext(ctx context.Context, msgs []*Message) (resp *BatchResponse, err error) {
+	if c.tokens == nil {
+		return nil, errors.New("fcm: client is not configured for HTTP v1 API")
+	}
+	if len(msgs) == 0 {
+		return nil, errors.New("fcm: no messages in batch")
+	}
+	if len(msgs) > MaxBatchSize {
+		return nil, errors.New("fcm: too many messages in batch")
+	}
+	if err := c.startSend(); err != nil {
+		return nil, err
+	}
+	defer c.endSend()
+
+	var statusCode int
+	ctx, end := c.startSpan(ctx, "fcm.SendBatch", Attribute{Key: AttributeMessages, Value: len(msgs)})
+	defer func() { end(statusCode, err) }()
+
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	auth, err := c.authorization(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pack each message as an embedded HTTP request.
+	var payload bytes.Buffer
+	writer := multipart.NewWriter(&payload)
+	sendPath := fmt.Sprintf(v1SendPath, c.projectID)
+	for i, msg := range msgs {
+		body, err := json.Marshal(map[string]interface{}{"message": msg})
+		if err != nil {
+			return nil, err
+		}
+
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {"application/http"},
+			"Content-Transfer-Encoding": {"binary"},
+			"Content-Id":                {strconv.Itoa(i + 1)},
+		})
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(part, "POST %s HTTP/1.1\r\n", sendPath)
+		fmt.Fprintf(part, "Content-Length: %d\r\n", len(body))
+		fmt.Fprintf(part, "Content-Type: application/json; charset=UTF-8\r\n\r\n")
+		part.Write(body)
+	}
+	if err = writer.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.fcmURL+batchPath, &payload)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(c.withClientTrace(ctx))
+	req.Header.Add(http.CanonicalHeaderKey("Content-Type"), "multipart/mixed; boundary="+writer.Boundary())
+	req.Header.Add(http.CanonicalHeaderKey("Authorization"), auth)
+
+	c.addHeaders(req)
+	httpResp, body, err := roundTrip(c.connection, req)
+	if err != nil {
+		return nil, err
+	}
+	statusCode = httpResp.StatusCode
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, newHttpError(httpResp, body)
+	}
+
+	return parseBatchResponse(httpResp, body, len(msgs))
+}
+
+// parseBatchResponse decodes the multipart response with one embedded HTTP response per message.
+func parseBatchResponse(httpResp *http.Response, body []byte, count int) (*BatchResponse, error) {
+	mediaType, params, err := mime.ParseMediaType(httpResp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return nil, errors.New("fcm: unexpected batch response type '" + mediaType + "'")
+	}
+
+	response := &BatchResponse{Responses: make([]BatchResult, count)}
+	received := make([]bool, count)
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for i := 0; ; i++ {
+		part, err := reader.NextPart()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+
+		// Response Content-ID is "response-N" where N is the Content-ID of the request part.
+		index := i
+		if id := strings.TrimPrefix(strings.Trim(part.Header.Get("Content-Id"), "<>"), "response-"); id != "" {
+			if n, err := strconv.Atoi(id); err == nil {
+				index = n - 1
+			}
+		}
+		if index < 0 || index >= count {
+			return nil, errors.New("fcm: unexpected part in batch response")
+		}
+
+		partResp, err := http.ReadResponse(bufio.NewReader(part), nil)
+		if err != nil {
+			return nil, err
+		}
+		partBody, err := ioutil.ReadAll(partResp.Body)
+		partResp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := decodeV1Response(partResp, partBody)
+		response.Responses[index] = BatchResult{Response: resp, Err: err}
+		received[index] = true
+	}
+
+	for i := range received {
+		if !received[i] {
+			response.Responses[i].Err = errors.New("fcm: no response for the message in batch")
+		}
+		if response.Responses[i].Err != nil {
+			response.FailureCount++
+		} else {
+			response.SuccessCount++
+		}
+	}
+
+	return response, nil
+}
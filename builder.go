@@ -0,0 +1,166 @@
+package fcm
+
+import (
+	"strings"
+	"time"
+)
+
+// MessageBuilder builds HttpMessage using chained setters, e.g.
+//
+//	msg, err := fcm.NewMessage().ToToken(token).WithTitle("Hello").HighPriority().Build()
+type MessageBuilder struct {
+	msg HttpMessage
+	err error
+}
+
+// NewMessage starts building a new message.
+func NewMessage() *MessageBuilder {
+	return &MessageBuilder{}
+}
+
+// ToToken sends the message to a single registration token.
+func (b *MessageBuilder) ToToken(token string) *MessageBuilder {
+	b.msg.To = token
+	return b
+}
+
+// ToTokens sends the message to up to MaxRegistrationIds registration tokens.
+func (b *MessageBuilder) ToTokens(tokens ...string) *MessageBuilder {
+	b.msg.RegistrationIds = tokens
+	return b
+}
+
+// ToTopic sends the message to the topic. The topic name may include the "/topics/" prefix.
+func (b *MessageBuilder) ToTopic(topic string) *MessageBuilder {
+	if err := ValidateTopic(topic); err != nil {
+		b.setError(err)
+		return b
+	}
+	b.msg.To = topicPrefix + strings.TrimPrefix(topic, topicPrefix)
+	return b
+}
+
+// ToCondition sends the message to devices subscribed to topics matching the condition,
+// e.g. "'dogs' in topics || 'cats' in topics".
+func (b *MessageBuilder) ToCondition(condition string) *MessageBuilder {
+	b.msg.Condition = condition
+	return b
+}
+
+// ToTopicCondition sends the message to devices subscribed to topics matching the condition.
+func (b *MessageBuilder) ToTopicCondition(cond Condition) *MessageBuilder {
+	expr, err := cond.Expression()
+	if err != nil {
+		b.setError(err)
+		return b
+	}
+	b.msg.Condition = expr
+	return b
+}
+
+// WithTitle sets the notification title.
+func (b *MessageBuilder) WithTitle(title string) *MessageBuilder {
+	b.notification().Title = title
+	return b
+}
+
+// WithBody sets the notification body.
+func (b *MessageBuilder) WithBody(body string) *MessageBuilder {
+	b.notification().Body = body
+	return b
+}
+
+// WithNotification sets the entire notification block.
+func (b *MessageBuilder) WithNotification(n *Notification) *MessageBuilder {
+	b.msg.Notification = n
+	return b
+}
+
+// WithData sets the data payload, e.g. map[string]string.
+func (b *MessageBuilder) WithData(data interface{}) *MessageBuilder {
+	b.msg.Data = data
+	return b
+}
+
+// HighPriority sends the message with high priority.
+func (b *MessageBuilder) HighPriority() *MessageBuilder {
+	b.msg.Priority = PriorityHigh
+	return b
+}
+
+// NormalPriority sends the message with normal priority.
+func (b *MessageBuilder) NormalPriority() *MessageBuilder {
+	b.msg.Priority = PriorityNormal
+	return b
+}
+
+// CollapseKey sets the key of a group of messages which can be collapsed.
+func (b *MessageBuilder) CollapseKey(key string) *MessageBuilder {
+	b.msg.CollapseKey = key
+	return b
+}
+
+// ContentAvailable wakes up an inactive client app on iOS.
+func (b *MessageBuilder) ContentAvailable() *MessageBuilder {
+	b.msg.ContentAvailable = true
+	return b
+}
+
+// MutableContent lets the iOS Notification Service Extension modify the notification.
+func (b *MessageBuilder) MutableContent() *MessageBuilder {
+	b.msg.MutableContent = true
+	return b
+}
+
+// TTL sets how long the message is kept in FCM storage if the device is offline, rounded
+// down to seconds, at most MaxTimeToLive.
+func (b *MessageBuilder) TTL(ttl time.Duration) *MessageBuilder {
+	if err := b.msg.SetTTL(ttl); err != nil {
+		b.setError(err)
+	}
+	return b
+}
+
+// RestrictedPackageName limits delivery to the Android app with the given package name.
+func (b *MessageBuilder) RestrictedPackageName(name string) *MessageBuilder {
+	b.msg.RestrictedPackageName = name
+	return b
+}
+
+// DryRun makes FCM validate the message without delivering it.
+func (b *MessageBuilder) DryRun() *MessageBuilder {
+	b.msg.DryRun = true
+	return b
+}
+
+// Build validates and returns the message. The builder can be reused after Build.
+func (b *MessageBuilder) Build() (*HttpMessage, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	if err := b.msg.Validate(); err != nil {
+		return nil, err
+	}
+
+	msg := b.msg
+	if b.msg.Notification != nil {
+		n := *b.msg.Notification
+		msg.Notification = &n
+	}
+	return &msg, nil
+}
+
+func (b *MessageBuilder) notification() *Notification {
+	if b.msg.Notification == nil {
+		b.msg.Notification = &Notification{}
+	}
+	return b.msg.Notification
+}
+
+// setError remembers the first error to report it from Build.
+func (b *MessageBuilder) setError(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
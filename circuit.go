@@ -0,0 +1,187 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without contacting the server while the circuit breaker is open.
+var ErrCircuitOpen = errors.New("fcm: circuit breaker is open")
+
+const (
+	defaultCircuitFailureThreshold = 5
+	defaultCircuitOpenTimeout      = 30 * time.Second
+)
+
+// CircuitState is the state of the circuit breaker.
+type CircuitState int
+
+const (
+	// CircuitClosed lets all requests through.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails all requests with ErrCircuitOpen.
+	CircuitOpen
+	// CircuitHalfOpen lets one probe request through to check if the server has recovered.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreakerConfig configures the circuit breaker, see WithCircuitBreaker.
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failed requests which open the circuit.
+	// Default 5.
+	FailureThreshold int
+	// OpenTimeout is the time the circuit stays open before a probe request is let through.
+	// Default 30 seconds.
+	OpenTimeout time.Duration
+	// OnStateChange is called on every state change, optional. It's called synchronously
+	// while holding the lock of the breaker and must not send messages.
+	OnStateChange func(from, to CircuitState)
+}
+
+// WithCircuitBreaker makes the client stop sending requests after consecutive failures: network
+// errors, timeouts and 5xx responses. While the circuit is open, requests fail immediately with
+// ErrCircuitOpen. After OpenTimeout one probe request is let through: if it succeeds, the circuit
+// is closed, otherwise it's open again. Legacy and HTTP v1 API requests share the breaker.
+func WithCircuitBreaker(cfg CircuitBreakerConfig) Option {
+	return func(o *clientOptions) {
+		if cfg.FailureThreshold <= 0 {
+			cfg.FailureThreshold = defaultCircuitFailureThreshold
+		}
+		if cfg.OpenTimeout <= 0 {
+			cfg.OpenTimeout = defaultCircuitOpenTimeout
+		}
+		o.circuit = &cfg
+	}
+}
+
+// CircuitState returns the state of the circuit breaker, CircuitClosed if the client has none.
+func (c *Client) CircuitState() CircuitState {
+	if c.breaker == nil {
+		return CircuitClosed
+	}
+	c.breaker.mu.Lock()
+	defer c.breaker.mu.Unlock()
+	return c.breaker.currentState(time.Now())
+}
+
+type circuitBreaker struct {
+	cfg CircuitBreakerConfig
+
+	mu    sync.Mutex
+	state CircuitState
+	// Consecutive failures in the closed state.
+	failures int
+	// Time when the circuit was opened.
+	openedAt time.Time
+	// The probe request is in flight.
+	probing bool
+}
+
+func newCircuitBreaker(cfg *CircuitBreakerConfig) *circuitBreaker {
+	return &circuitBreaker{cfg: *cfg}
+}
+
+// currentState returns the state, the open circuit becomes half-open after the timeout.
+func (b *circuitBreaker) currentState(now time.Time) CircuitState {
+	if b.state == CircuitOpen && now.Sub(b.openedAt) >= b.cfg.OpenTimeout {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
+
+func (b *circuitBreaker) setState(state CircuitState) {
+	if b.state == state {
+		return
+	}
+	from := b.state
+	b.state = state
+	if b.cfg.OnStateChange != nil {
+		b.cfg.OnStateChange(from, state)
+	}
+}
+
+// allow checks if the request may be sent. If allowed, the outcome must be reported with done.
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.currentState(time.Now()) {
+	case CircuitOpen:
+		return ErrCircuitOpen
+	case CircuitHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.setState(CircuitHalfOpen)
+		b.probing = true
+	}
+	return nil
+}
+
+// done reports the outcome of an allowed request.
+func (b *circuitBreaker) done(statusCode int, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	failed := circuitFailure(statusCode, err)
+	if b.state == CircuitHalfOpen {
+		b.probing = false
+		if failed {
+			b.open()
+		} else {
+			b.failures = 0
+			b.setState(CircuitClosed)
+		}
+		return
+	}
+
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.cfg.FailureThreshold {
+		b.open()
+	}
+}
+
+func (b *circuitBreaker) open() {
+	b.failures = 0
+	b.openedAt = time.Now()
+	b.setState(CircuitOpen)
+}
+
+// circuitFailure checks if the outcome of the request indicates a problem with the server.
+// Cancellation by the caller and rejections of the message, like 400, are not failures.
+func circuitFailure(statusCode int, err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	return statusCode == 0 || statusCode >= http.StatusInternalServerError
+}
+
+// allowRequest checks the circuit breaker, if any. The returned function reports the outcome.
+func (c *Client) allowRequest() (func(statusCode int, err error), error) {
+	if c.breaker == nil {
+		return func(int, error) {}, nil
+	}
+	if err := c.breaker.allow(); err != nil {
+		return nil, err
+	}
+	return c.breaker.done, nil
+}
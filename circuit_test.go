@@ -0,0 +1,114 @@
+package fcm
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// statusServer is a legacy HTTP API server which responds with the given status and counts
+// the requests.
+type statusServer struct {
+	*httptest.Server
+	status   int32
+	requests int32
+}
+
+func newStatusServer(t *testing.T, status int) *statusServer {
+	s := &statusServer{status: int32(status)}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.requests, 1)
+		if status := int(atomic.LoadInt32(&s.status)); status != http.StatusOK {
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"multicast_id":1,"success":1,"results":[{"message_id":"0:1"}]}`))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *statusServer) setStatus(status int) {
+	atomic.StoreInt32(&s.status, int32(status))
+}
+
+func (s *statusServer) count() int {
+	return int(atomic.LoadInt32(&s.requests))
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	srv := newStatusServer(t, http.StatusServiceUnavailable)
+	var changes []CircuitState
+	c := NewClient("key", WithBaseURL(srv.URL), WithCircuitBreaker(CircuitBreakerConfig{
+		FailureThreshold: 2,
+		OpenTimeout:      50 * time.Millisecond,
+		OnStateChange:    func(from, to CircuitState) { changes = append(changes, to) },
+	}))
+	defer c.Close(context.Background())
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.SendHttp(&HttpMessage{To: "a"}); err == nil || err == ErrCircuitOpen {
+			t.Fatalf("send %d = %v, want the server error", i, err)
+		}
+	}
+	if state := c.CircuitState(); state != CircuitOpen {
+		t.Fatalf("state after failures = %v, want open", state)
+	}
+	if _, err := c.SendHttp(&HttpMessage{To: "a"}); err != ErrCircuitOpen {
+		t.Errorf("send while open = %v, want ErrCircuitOpen", err)
+	}
+	if n := srv.count(); n != 2 {
+		t.Errorf("server received %d requests, want 2", n)
+	}
+
+	// The probe after the timeout fails and opens the circuit again.
+	time.Sleep(60 * time.Millisecond)
+	if state := c.CircuitState(); state != CircuitHalfOpen {
+		t.Fatalf("state after timeout = %v, want half-open", state)
+	}
+	if _, err := c.SendHttp(&HttpMessage{To: "a"}); err == nil || err == ErrCircuitOpen {
+		t.Fatalf("failed probe = %v, want the server error", err)
+	}
+	if state := c.CircuitState(); state != CircuitOpen {
+		t.Fatalf("state after failed probe = %v, want open", state)
+	}
+
+	// The successful probe closes the circuit.
+	srv.setStatus(http.StatusOK)
+	time.Sleep(60 * time.Millisecond)
+	if _, err := c.SendHttp(&HttpMessage{To: "a"}); err != nil {
+		t.Fatalf("probe = %v", err)
+	}
+	if state := c.CircuitState(); state != CircuitClosed {
+		t.Errorf("state after probe = %v, want closed", state)
+	}
+
+	want := []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitOpen, CircuitHalfOpen, CircuitClosed}
+	if len(changes) != len(want) {
+		t.Fatalf("state changes = %v, want %v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Fatalf("state changes = %v, want %v", changes, want)
+		}
+	}
+}
+
+func TestCircuitBreakerIgnoresRejections(t *testing.T) {
+	srv := newStatusServer(t, http.StatusBadRequest)
+	c := NewClient("key", WithBaseURL(srv.URL), WithCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1}))
+	defer c.Close(context.Background())
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.SendHttp(&HttpMessage{To: "a"}); err == nil || err == ErrCircuitOpen {
+			t.Fatalf("send %d = %v, want the server error", i, err)
+		}
+	}
+	if state := c.CircuitState(); state != CircuitClosed {
+		t.Errorf("state after rejections = %v, want closed", state)
+	}
+}
@@ -0,0 +1,78 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+// ErrClientClosed is returned by the send methods after Close has been called.
+var ErrClientClosed = errors.New("fcm: client is closed")
+
+// Close shuts the client down gracefully. New sends fail with ErrClientClosed, messages already
+// queued by PostHttp and Enqueue are still sent and pending retries are abandoned: the sends
+// return the error of their last attempt. Enqueue calls waiting for room in the queue fail
+// with ErrClientClosed. Close waits for in-flight sends until the context
+// is done and then closes idle connections. It returns the context error if the sends have not
+// completed in time. Calling Close more than once returns ErrClientClosed.
+func (c *Client) Close(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&c.closeStarted, 0, 1) {
+		return ErrClientClosed
+	}
+	// Sends waiting for room in the queue hold closeLock, they give up once closing is closed.
+	close(c.closing)
+
+	c.closeLock.Lock()
+	c.closed = true
+	// Workers exit after sending the queued messages.
+	if c.postQueue != nil {
+		close(c.postQueue)
+	}
+	if c.queue != nil {
+		close(c.queueHigh)
+		close(c.queue)
+	}
+	c.closeLock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		c.inflight.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	c.CloseIdleConnections()
+	return err
+}
+
+// isClosing returns true once Close has been called.
+func (c *Client) isClosing() bool {
+	select {
+	case <-c.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// startSend registers an in-flight send. It fails if the client is closed.
+// The send must be completed with endSend.
+func (c *Client) startSend() error {
+	c.closeLock.RLock()
+	defer c.closeLock.RUnlock()
+	if c.closed {
+		return ErrClientClosed
+	}
+	c.inflight.Add(1)
+	return nil
+}
+
+// endSend marks the in-flight send as completed.
+func (c *Client) endSend() {
+	c.inflight.Done()
+}
@@ -0,0 +1,92 @@
+package fcm
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCloseReleasesBlockedEnqueue(t *testing.T) {
+	srv := newGateServer(t)
+	c := NewClient("key", WithBaseURL(srv.URL), WithQueue(QueueConfig{Workers: 1, Capacity: 1}))
+
+	// The worker is busy and the queue is full.
+	if err := c.Enqueue(context.Background(), &HttpMessage{To: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	srv.waitReceived(t, 1)
+	if err := c.Enqueue(context.Background(), &HttpMessage{To: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	blocked := make(chan error, 1)
+	go func() {
+		blocked <- c.Enqueue(context.Background(), &HttpMessage{To: "c"})
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	closed := make(chan error, 1)
+	go func() {
+		closed <- c.Close(ctx)
+	}()
+
+	select {
+	case err := <-blocked:
+		if err != ErrClientClosed {
+			t.Errorf("blocked Enqueue = %v, want ErrClientClosed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not release the blocked Enqueue")
+	}
+	select {
+	case err := <-closed:
+		if err != context.DeadlineExceeded {
+			t.Errorf("Close = %v, want context.DeadlineExceeded while the send is held", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close ignored the context")
+	}
+	srv.open()
+}
+
+func TestCloseDrainsQueue(t *testing.T) {
+	srv := newGateServer(t)
+	results := newQueueResults()
+	c := NewClient("key", WithBaseURL(srv.URL), WithQueue(QueueConfig{Workers: 2, OnResult: results.onResult}))
+
+	tokens := []string{"a", "b", "c", "d", "e"}
+	for _, to := range tokens {
+		if err := c.Enqueue(context.Background(), &HttpMessage{To: to}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	srv.waitReceived(t, 2)
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- c.Close(context.Background())
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if err := c.Enqueue(context.Background(), &HttpMessage{To: "f"}); err != ErrClientClosed {
+		t.Errorf("Enqueue after Close = %v, want ErrClientClosed", err)
+	}
+	select {
+	case err := <-closed:
+		t.Fatalf("Close = %v before the queued messages were sent", err)
+	default:
+	}
+
+	srv.open()
+	if err := <-closed; err != nil {
+		t.Fatal(err)
+	}
+	for _, to := range tokens {
+		if err, ok := results.get(to); !ok || err != nil {
+			t.Errorf("result of %s = %v, %v, want sent", to, err, ok)
+		}
+	}
+	if n := len(srv.waitReceived(t, len(tokens))); n != len(tokens) {
+		t.Errorf("received %d messages, want %d", n, len(tokens))
+	}
+}
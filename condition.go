@@ -0,0 +1,104 @@
+package fcm
+
+import (
+	"errors"
+	"strings"
+)
+
+// MaxConditionTopics is the maximum number of topics in a condition.
+const MaxConditionTopics = 5
+
+// Condition is a boolean expression over topic subscriptions, e.g.
+//
+//	fcm.And(fcm.Topic("dogs"), fcm.Or(fcm.Topic("cats"), fcm.Topic("birds")))
+//
+// serializes to "'dogs' in topics && ('cats' in topics || 'birds' in topics)".
+type Condition struct {
+	// Topic name if the condition is a single topic.
+	topic string
+	// Operator "&&" or "||" combining operands.
+	op       string
+	operands []Condition
+}
+
+// Topic is a condition satisfied by devices subscribed to the topic.
+func Topic(name string) Condition {
+	return Condition{topic: strings.TrimPrefix(name, topicPrefix)}
+}
+
+// And is a condition satisfied when all of the conditions are satisfied.
+func And(conds ...Condition) Condition {
+	return Condition{op: "&&", operands: conds}
+}
+
+// Or is a condition satisfied when any of the conditions is satisfied.
+func Or(conds ...Condition) Condition {
+	return Condition{op: "||", operands: conds}
+}
+
+// Topics returns the number of topics in the condition.
+func (c Condition) Topics() int {
+	if c.op == "" {
+		return 1
+	}
+	count := 0
+	for _, operand := range c.operands {
+		count += operand.Topics()
+	}
+	return count
+}
+
+// Expression validates and serializes the condition for HttpMessage.Condition.
+func (c Condition) Expression() (string, error) {
+	if c.Topics() > MaxConditionTopics {
+		return "", errors.New("fcm: condition has too many topics")
+	}
+	var sb strings.Builder
+	if err := c.write(&sb, ""); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// String returns the condition expression without validation.
+func (c Condition) String() string {
+	var sb strings.Builder
+	c.write(&sb, "")
+	return sb.String()
+}
+
+// write serializes the condition parenthesizing it if the operator differs from the parent's.
+func (c Condition) write(sb *strings.Builder, parentOp string) error {
+	if c.op == "" {
+		if err := ValidateTopic(c.topic); err != nil {
+			return err
+		}
+		sb.WriteString("'" + c.topic + "' in topics")
+		return nil
+	}
+
+	if len(c.operands) == 0 {
+		return errors.New("fcm: empty condition")
+	}
+	if len(c.operands) == 1 {
+		return c.operands[0].write(sb, parentOp)
+	}
+
+	parens := parentOp != "" && parentOp != c.op
+	if parens {
+		sb.WriteString("(")
+	}
+	var err error
+	for i, operand := range c.operands {
+		if i > 0 {
+			sb.WriteString(" " + c.op + " ")
+		}
+		if e := operand.write(sb, c.op); e != nil && err == nil {
+			err = e
+		}
+	}
+	if parens {
+		sb.WriteString(")")
+	}
+	return err
+}
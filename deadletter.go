@@ -0,0 +1,43 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+)
+
+// WithDeadLetter sets the function called with the message and the final error when a send
+// with SendHttp, PostHttp, SendMulticast or Enqueue fails after all retries or with a fatal
+// error, so the application can persist or alert on undeliverable messages. Sends canceled by
+// the caller, suppressed duplicates and invalid messages are not reported. The function is called synchronously on the sending go
+// routine and may be called concurrently.
+func WithDeadLetter(fn func(msg *HttpMessage, err error)) Option {
+	return func(o *clientOptions) {
+		o.deadLetter = fn
+	}
+}
+
+// WithDeadLetterV1 is the same as WithDeadLetter for messages sent with SendV1.
+func WithDeadLetterV1(fn func(msg *Message, err error)) Option {
+	return func(o *clientOptions) {
+		o.deadLetterV1 = fn
+	}
+}
+
+// undeliverable checks if the error of the send should be reported as a dead letter.
+func undeliverable(err error) bool {
+	return err != nil && !errors.Is(err, context.Canceled) && !errors.Is(err, ErrDuplicate)
+}
+
+// deadLetter reports the message which could not be sent.
+func (c *Client) deadLetter(msg *HttpMessage, err error) {
+	if c.onDeadLetter != nil && undeliverable(err) {
+		c.onDeadLetter(msg, err)
+	}
+}
+
+// deadLetterV1 reports the HTTP v1 message which could not be sent.
+func (c *Client) deadLetterV1(msg *Message, err error) {
+	if c.onDeadLetterV1 != nil && undeliverable(err) {
+		c.onDeadLetterV1(msg, err)
+	}
+}
@@ -0,0 +1,111 @@
+package fcm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"sort"
+	"strings"
+)
+
+const redacted = "REDACTED"
+
+// streamedBodyKey is the context key marking requests with a streamed body, see
+// WithStreamingBody. Such bodies are not dumped.
+type streamedBodyKey struct{}
+
+// debugTransport dumps requests and responses with credentials redacted.
+type debugTransport struct {
+	next http.RoundTripper
+	logf func(format string, args ...interface{})
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.logf("fcm: request: %s", dumpRequest(req))
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.logf("fcm: request failed: %v", err)
+		return resp, err
+	}
+
+	// Read the body to dump it and replace it with a copy.
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		t.logf("fcm: reading response failed: %v", err)
+		return resp, nil
+	}
+
+	dump, _ := httputil.DumpResponse(&http.Response{
+		Status:        resp.Status,
+		StatusCode:    resp.StatusCode,
+		Proto:         resp.Proto,
+		ProtoMajor:    resp.ProtoMajor,
+		ProtoMinor:    resp.ProtoMinor,
+		Header:        resp.Header,
+		ContentLength: resp.ContentLength,
+	}, false)
+	if bytes.Contains(body, []byte(`"access_token"`)) {
+		body = []byte(redacted)
+	}
+	t.logf("fcm: response: %s%s", dump, body)
+	return resp, nil
+}
+
+// dumpRequest formats the request without consuming its body.
+func dumpRequest(req *http.Request) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s\r\n", req.Method, req.URL)
+
+	keys := make([]string, 0, len(req.Header))
+	for key := range req.Header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range req.Header[key] {
+			if key == "Authorization" {
+				// Keep the scheme, e.g. "key=" or "Bearer".
+				if i := strings.IndexAny(value, "= "); i >= 0 {
+					value = value[:i+1] + redacted
+				} else {
+					value = redacted
+				}
+			}
+			fmt.Fprintf(&sb, "%s: %s\r\n", key, value)
+		}
+	}
+	sb.WriteString("\r\n")
+
+	if streamed, _ := req.Context().Value(streamedBodyKey{}).(bool); streamed {
+		sb.WriteString("<streamed body>")
+		return sb.String()
+	}
+	if req.GetBody == nil {
+		return sb.String()
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return sb.String()
+	}
+	defer body.Close()
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		// OAuth2 token requests include credentials.
+		sb.WriteString(redacted)
+		return sb.String()
+	}
+	if encoding := req.Header.Get("Content-Encoding"); encoding != "" {
+		// Compressed bodies are binary.
+		n, _ := io.Copy(ioutil.Discard, body)
+		fmt.Fprintf(&sb, "<%d bytes %s>", n, encoding)
+		return sb.String()
+	}
+	content, _ := ioutil.ReadAll(body)
+	sb.Write(content)
+	return sb.String()
+}
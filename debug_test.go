@@ -0,0 +1,49 @@
+package fcm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestDebugLoggerBodies(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want string
+	}{
+		{"plain", nil, `"to":"a"`},
+		{"gzip", []Option{WithGzip()}, " bytes gzip>"},
+		{"streamed", []Option{WithStreamingBody()}, "<streamed body>"},
+		{"streamed gzip", []Option{WithStreamingBody(), WithGzip()}, "<streamed body>"},
+	}
+	for _, tt := range tests {
+		srv := newGateServer(t)
+		srv.open()
+
+		var mu sync.Mutex
+		var dumps []string
+		logf := func(format string, args ...interface{}) {
+			mu.Lock()
+			dumps = append(dumps, fmt.Sprintf(format, args...))
+			mu.Unlock()
+		}
+		c := NewClient("secret", append([]Option{WithBaseURL(srv.URL), WithDebugLogger(logf)}, tt.opts...)...)
+		if _, err := c.SendHttp(&HttpMessage{To: "a"}); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		c.Close(context.Background())
+
+		mu.Lock()
+		request := dumps[0]
+		mu.Unlock()
+		if !strings.Contains(request, tt.want) {
+			t.Errorf("%s: request dump %q does not contain %q", tt.name, request, tt.want)
+		}
+		if strings.Contains(request, "secret") {
+			t.Errorf("%s: request dump %q contains the API key", tt.name, request)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package fcm
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrDuplicate is returned when the message has the same IdempotencyKey as a message sent
+// within the deduplication window, see WithDedup.
+var ErrDuplicate = errors.New("fcm: duplicate message suppressed")
+
+// WithDedup suppresses duplicate sends: a message with a non-empty IdempotencyKey fails with
+// ErrDuplicate if a message with the same key has been sent or is being sent within the window.
+// If the send fails, the key is forgotten so the message can be retried.
+func WithDedup(window time.Duration) Option {
+	return func(o *clientOptions) {
+		o.dedupWindow = window
+	}
+}
+
+// Expired keys are swept every dedupSweepInterval claims.
+const dedupSweepInterval = 1000
+
+// dedupCache remembers idempotency keys of recent sends.
+type dedupCache struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	expires map[string]time.Time
+	claims  int
+}
+
+func newDedupCache(window time.Duration) *dedupCache {
+	return &dedupCache{window: window, expires: make(map[string]time.Time)}
+}
+
+// claim records the key. It returns false if the key is already recorded within the window.
+func (d *dedupCache) claim(key string) bool {
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.claims++
+	if d.claims%dedupSweepInterval == 0 {
+		for k, exp := range d.expires {
+			if !now.Before(exp) {
+				delete(d.expires, k)
+			}
+		}
+	}
+
+	if exp, found := d.expires[key]; found && now.Before(exp) {
+		return false
+	}
+	d.expires[key] = now.Add(d.window)
+	return true
+}
+
+// release forgets the key.
+func (d *dedupCache) release(key string) {
+	d.mu.Lock()
+	delete(d.expires, key)
+	d.mu.Unlock()
+}
+
+// claimKey registers the send of the message with the idempotency key. The returned function
+// must be called with the outcome of the send.
+func (c *Client) claimKey(key string) (func(err error), error) {
+	if c.dedup == nil || key == "" {
+		return func(error) {}, nil
+	}
+	if !c.dedup.claim(key) {
+		return nil, ErrDuplicate
+	}
+	return func(err error) {
+		if err != nil {
+			c.dedup.release(key)
+		}
+	}, nil
+}
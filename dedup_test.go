@@ -0,0 +1,48 @@
+package fcm
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSendHttpDedup(t *testing.T) {
+	srv := newStatusServer(t, http.StatusOK)
+	c := NewClient("key", WithBaseURL(srv.URL), WithDedup(time.Minute))
+	defer c.Close(context.Background())
+
+	if _, err := c.SendHttp(&HttpMessage{To: "a", IdempotencyKey: "k"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.SendHttp(&HttpMessage{To: "a", IdempotencyKey: "k"}); err != ErrDuplicate {
+		t.Errorf("duplicate send = %v, want ErrDuplicate", err)
+	}
+	// Messages without the key are never suppressed.
+	for i := 0; i < 2; i++ {
+		if _, err := c.SendHttp(&HttpMessage{To: "a"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := srv.count(); n != 3 {
+		t.Errorf("server received %d requests, want 3", n)
+	}
+}
+
+func TestSendHttpDedupReleasesFailed(t *testing.T) {
+	srv := newStatusServer(t, http.StatusServiceUnavailable)
+	c := NewClient("key", WithBaseURL(srv.URL), WithDedup(time.Minute))
+	defer c.Close(context.Background())
+
+	if _, err := c.SendHttp(&HttpMessage{To: "a", IdempotencyKey: "k"}); err == nil {
+		t.Fatal("send succeeded, want the server error")
+	}
+	// The failed message may be sent again.
+	srv.setStatus(http.StatusOK)
+	if _, err := c.SendHttp(&HttpMessage{To: "a", IdempotencyKey: "k"}); err != nil {
+		t.Errorf("retry of the failed send = %v, want nil", err)
+	}
+	if n := srv.count(); n != 2 {
+		t.Errorf("server received %d requests, want 2", n)
+	}
+}
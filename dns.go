@@ -0,0 +1,110 @@
+package fcm
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// WithResolver makes the client resolve server names with the given resolver instead of
+// net.DefaultResolver, e.g. to use a specific DNS server.
+func WithResolver(resolver *net.Resolver) Option {
+	return func(o *clientOptions) {
+		o.resolver = resolver
+	}
+}
+
+// WithDNSCache makes the client cache resolved server addresses for the ttl. If a lookup
+// fails, the expired addresses are used until the name is resolved successfully again.
+func WithDNSCache(ttl time.Duration) Option {
+	return func(o *clientOptions) {
+		o.dnsCacheTTL = ttl
+	}
+}
+
+// dnsCache caches addresses of hosts.
+type dnsCache struct {
+	resolver *net.Resolver
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]dnsEntry
+}
+
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+func newDNSCache(resolver *net.Resolver, ttl time.Duration) *dnsCache {
+	return &dnsCache{resolver: resolver, ttl: ttl, entries: make(map[string]dnsEntry)}
+}
+
+// lookup returns the cached addresses of the host or resolves it.
+func (c *dnsCache) lookup(ctx context.Context, host string) ([]string, error) {
+	c.mu.Lock()
+	entry, found := c.entries[host]
+	c.mu.Unlock()
+	if found && time.Now().Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	addrs, err := c.resolver.LookupHost(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		if found {
+			// Stale addresses are better than failing the request.
+			return entry.addrs, nil
+		}
+		if err == nil {
+			err = &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		}
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.entries[host] = dnsEntry{addrs: addrs, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+	return addrs, nil
+}
+
+// dialFunc is the signature of net.Dialer.DialContext.
+type dialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// resolvingDial returns the dial function which resolves hosts with lookup, orders the addresses
+// by the IP family preference and tries them in order until one of them connects.
+func resolvingDial(lookup func(ctx context.Context, host string) ([]string, error), family IPFamily,
+	dial dialFunc) dialFunc {
+
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		network = family.network(network)
+		host, port, err := net.SplitHostPort(address)
+		if err != nil || net.ParseIP(host) != nil {
+			return dial(ctx, network, address)
+		}
+
+		addrs, err := lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		addrs = family.order(addrs)
+		if len(addrs) == 0 {
+			return nil, &net.DNSError{Err: "no addresses of the required IP family", Name: host}
+		}
+
+		var firstErr error
+		for _, addr := range addrs {
+			conn, err := dial(ctx, network, net.JoinHostPort(addr, port))
+			if err == nil {
+				return conn, nil
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		return nil, firstErr
+	}
+}
@@ -0,0 +1,159 @@
+package fcm
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// Buffers larger than this are not returned to the pool to avoid holding much memory
+// after sending a single large message.
+const maxPooledBufferSize = 1 << 20
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		b := &jsonBuffer{}
+		b.enc = json.NewEncoder(&b.buf)
+		return b
+	},
+}
+
+// requestBody is the payload of requests which may be sent more than once, e.g. when retrying.
+type requestBody interface {
+	// body returns a new reader of the payload.
+	body() io.ReadCloser
+	// contentLength returns the size of the payload or -1 if it's not known in advance.
+	contentLength() int64
+	// size returns the number of bytes of the payload read by the last request.
+	size() int
+	// release is called when the payload is no longer needed.
+	release()
+}
+
+// jsonBuffer is a pooled buffer with JSON-encoded payload of requests. It's returned to the pool
+// when the owner and all request bodies reading from it are done with it.
+type jsonBuffer struct {
+	buf bytes.Buffer
+	// Encoder writing to buf.
+	enc *json.Encoder
+	// Number of owners: the caller of encodeJSON and open request bodies.
+	refs int32
+}
+
+// encodeJSON encodes the value to JSON using a buffer from the pool. The release method
+// must be called once the buffer is no longer needed.
+func encodeJSON(v interface{}) (*jsonBuffer, error) {
+	b := bufferPool.Get().(*jsonBuffer)
+	b.refs = 1
+	if err := b.enc.Encode(v); err != nil {
+		b.release()
+		return nil, err
+	}
+	return b, nil
+}
+
+// encodeBody returns the request body with the legacy HTTP API message: streamed if enabled
+// with WithStreamingBody, otherwise encoded into a pooled buffer. The release method must be
+// called once the body is no longer needed.
+func (c *Client) encodeBody(msg *HttpMessage) (requestBody, error) {
+	if c.streamBody {
+		return &jsonStream{v: msg}, nil
+	}
+	buf, err := encodeJSON(msg)
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// Bytes returns the encoded payload. It's valid until the buffer is released.
+func (b *jsonBuffer) Bytes() []byte {
+	return b.buf.Bytes()
+}
+
+// Len returns the size of the encoded payload.
+func (b *jsonBuffer) Len() int {
+	return b.buf.Len()
+}
+
+func (b *jsonBuffer) contentLength() int64 {
+	return int64(b.buf.Len())
+}
+
+func (b *jsonBuffer) size() int {
+	return b.buf.Len()
+}
+
+// body returns a request body reading the payload. The buffer is kept out of the pool until
+// the body is closed. The Transport closes the body, possibly after RoundTrip has returned.
+func (b *jsonBuffer) body() io.ReadCloser {
+	atomic.AddInt32(&b.refs, 1)
+	return &bufferBody{Reader: bytes.NewReader(b.buf.Bytes()), buf: b}
+}
+
+// release drops a reference to the buffer and returns it to the pool after the last one.
+func (b *jsonBuffer) release() {
+	if atomic.AddInt32(&b.refs, -1) != 0 {
+		return
+	}
+	if b.buf.Cap() <= maxPooledBufferSize {
+		b.buf.Reset()
+		bufferPool.Put(b)
+	}
+}
+
+// bufferBody is a request body reading from jsonBuffer.
+type bufferBody struct {
+	*bytes.Reader
+	buf  *jsonBuffer
+	once sync.Once
+}
+
+func (b *bufferBody) Close() error {
+	b.once.Do(b.buf.release)
+	return nil
+}
+
+// jsonStream encodes the value directly into the request body without holding the entire
+// payload in memory.
+type jsonStream struct {
+	v interface{}
+	// Number of bytes written by the last encoder.
+	written int64
+}
+
+func (s *jsonStream) body() io.ReadCloser {
+	r, w := io.Pipe()
+	go func() {
+		cw := &countingWriter{w: w}
+		// Encoder fails if the reader is closed by the Transport, e.g. on a network error.
+		err := json.NewEncoder(cw).Encode(s.v)
+		atomic.StoreInt64(&s.written, cw.n)
+		w.CloseWithError(err)
+	}()
+	return r
+}
+
+func (s *jsonStream) contentLength() int64 {
+	return -1
+}
+
+func (s *jsonStream) size() int {
+	return int(atomic.LoadInt64(&s.written))
+}
+
+func (s *jsonStream) release() {}
+
+// countingWriter counts the bytes written to the underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,45 @@
+package fcm
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"testing"
+)
+
+func benchmarkMessage() *HttpMessage {
+	ids := make([]string, 500)
+	for i := range ids {
+		ids[i] = "token-" + strconv.Itoa(i)
+	}
+	return &HttpMessage{
+		RegistrationIds: ids,
+		Priority:        PriorityHigh,
+		Data:            map[string]interface{}{"topic": "grp1", "seq": 123},
+		Notification:    &Notification{Title: "New message", Body: "Hello"},
+	}
+}
+
+func BenchmarkEncodePooled(b *testing.B) {
+	msg := benchmarkMessage()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf, err := encodeJSON(msg)
+		if err != nil {
+			b.Fatal(err)
+		}
+		buf.release()
+	}
+}
+
+// BenchmarkEncodeNewEncoder encodes the message like before the buffers were pooled.
+func BenchmarkEncodeNewEncoder(b *testing.B) {
+	msg := benchmarkMessage()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package fcm
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Error codes reported by FCM HTTP v1 API in V1Error details, see V1Error.ErrorCode.
+const (
+	V1ErrorUnspecified           = "UNSPECIFIED_ERROR"
+	V1ErrorInvalidArgument       = "INVALID_ARGUMENT"
+	V1ErrorUnregistered          = "UNREGISTERED"
+	V1ErrorSenderIdMismatch      = "SENDER_ID_MISMATCH"
+	V1ErrorQuotaExceeded         = "QUOTA_EXCEEDED"
+	V1ErrorUnavailable           = "UNAVAILABLE"
+	V1ErrorInternal              = "INTERNAL"
+	V1ErrorThirdPartyAuthError   = "THIRD_PARTY_AUTH_ERROR"
+	V1ErrorApnsAuthError         = "APNS_AUTH_ERROR"
+	V1ErrorInvalidApnsCredential = "INVALID_APNS_CREDENTIAL"
+)
+
+// HttpError is returned when the server responds with HTTP status other than 200 OK.
+type HttpError struct {
+	// StatusCode is the HTTP status code of the response, e.g. 503.
+	StatusCode int
+	// Status is the HTTP status line, e.g. "503 Service Unavailable".
+	Status string
+	// Body is the body of the response.
+	Body string
+	// RetryAfter is the value of the Retry-After header, zero if the header is missing.
+	RetryAfter time.Duration
+}
+
+func newHttpError(resp *http.Response, body []byte) *HttpError {
+	return &HttpError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Body:       string(body),
+		RetryAfter: parseRetryAfter(resp.Header.Get(http.CanonicalHeaderKey("Retry-After"))),
+	}
+}
+
+func (e *HttpError) Error() string {
+	return e.Status + ": " + e.Body
+}
+
+// ResultError is an error reported by FCM for an individual message of a legacy API
+// request, see Result.Error. The Code is one of the Error* constants.
+type ResultError struct {
+	Code string
+}
+
+func (e ResultError) Error() string {
+	return "fcm: " + e.Code
+}
+
+// MulticastError is returned by SendMulticast together with the response if the message
+// could not be sent to some of the tokens. Use errors.Is to check for the individual errors,
+// e.g. errors.Is(err, fcm.ErrNotRegistered).
+type MulticastError struct {
+	// SuccessCount is the number of tokens the message was sent to.
+	SuccessCount int
+	// Failures are the failed tokens in the order of msg.RegistrationIds.
+	Failures []TokenError
+
+	// Distinct errors of the failures.
+	errs []error
+}
+
+// TokenError is the failure of the message sent to one token.
+type TokenError struct {
+	Token string
+	// Err is the ResultError reported for the token or the error of the request which
+	// carried the token.
+	Err error
+}
+
+func (e *MulticastError) Error() string {
+	if len(e.Failures) == 0 {
+		return fmt.Sprintf("fcm: failed to send to 0 of %d tokens", e.SuccessCount)
+	}
+	return fmt.Sprintf("fcm: failed to send to %d of %d tokens, first error: %v",
+		len(e.Failures), len(e.Failures)+e.SuccessCount, e.Failures[0].Err)
+}
+
+// Unwrap returns the distinct errors of the failures.
+func (e *MulticastError) Unwrap() []error {
+	return e.errs
+}
+
+// newMulticastError describes the failed tokens of the response, nil if there are none.
+func newMulticastError(resp *HttpResponse, chunkErrs []error) *MulticastError {
+	e := &MulticastError{}
+	codes := make(map[string]bool)
+	for i, r := range resp.Results {
+		if r.Error == "" {
+			continue
+		}
+		failure := TokenError{Err: ResultError{Code: r.Error}}
+		if i < len(resp.tokens) {
+			failure.Token = resp.tokens[i]
+		}
+		chunk := i / MaxRegistrationIds
+		switch {
+		case chunk < len(chunkErrs) && chunkErrs[chunk] != nil:
+			failure.Err = chunkErrs[chunk]
+			if i%MaxRegistrationIds == 0 {
+				e.errs = append(e.errs, failure.Err)
+			}
+		case !codes[r.Error]:
+			codes[r.Error] = true
+			e.errs = append(e.errs, failure.Err)
+		}
+		e.Failures = append(e.Failures, failure)
+	}
+	if len(e.Failures) == 0 {
+		return nil
+	}
+	e.SuccessCount = len(resp.Results) - len(e.Failures)
+	return e
+}
+
+// RetryAfter returns the delay requested by the server in the Retry-After header of
+// the failed response, zero if the error has no such information.
+func RetryAfter(err error) time.Duration {
+	var httpErr *HttpError
+	if errors.As(err, &httpErr) {
+		return httpErr.RetryAfter
+	}
+	var v1Err *V1Error
+	if errors.As(err, &v1Err) {
+		return v1Err.RetryAfter
+	}
+	return 0
+}
+
+// Errors reported for individual messages, returned by Result.ErrorValue. Use errors.Is
+// to check for them.
+var (
+	ErrMissingRegistration       = ResultError{Code: ErrorMissingRegistration}
+	ErrInvalidRegistration       = ResultError{Code: ErrorInvalidRegistration}
+	ErrNotRegistered             = ResultError{Code: ErrorNotRegistered}
+	ErrInvalidPackageName        = ResultError{Code: ErrorInvalidPackageName}
+	ErrMismatchSenderId          = ResultError{Code: ErrorMismatchSenderId}
+	ErrMessageTooBig             = ResultError{Code: ErrorMessageTooBig}
+	ErrInvalidDataKey            = ResultError{Code: ErrorInvalidDataKey}
+	ErrInvalidTtl                = ResultError{Code: ErrorInvalidTtl}
+	ErrUnavailable               = ResultError{Code: ErrorUnavailable}
+	ErrInternalServerError       = ResultError{Code: ErrorInternalServerError}
+	ErrDeviceMessageRateExceeded = ResultError{Code: ErrorDeviceMessageRateExceeded}
+	ErrTopicsMessageRateExceeded = ResultError{Code: ErrorTopicsMessageRateExceeded}
+)
+
+// ErrorValue returns the error of the result as ResultError, nil if the message was sent
+// successfully. The returned value is equal to one of Err* variables if the code is known,
+// e.g. errors.Is(result.ErrorValue(), fcm.ErrNotRegistered).
+func (r *Result) ErrorValue() error {
+	if r.Error == "" {
+		return nil
+	}
+	return ResultError{Code: r.Error}
+}
+
+// IsRetryable checks if the error is transient and the send may succeed if retried later.
+func IsRetryable(err error) bool {
+	var httpErr *HttpError
+	if errors.As(err, &httpErr) {
+		return retryableStatus(httpErr.StatusCode)
+	}
+	var resultErr ResultError
+	if errors.As(err, &resultErr) {
+		return isRetryableCode(resultErr.Code)
+	}
+	var v1Err *V1Error
+	if errors.As(err, &v1Err) {
+		switch v1Err.ErrorCode() {
+		case V1ErrorUnavailable, V1ErrorInternal, V1ErrorQuotaExceeded:
+			return true
+		}
+		return retryableStatus(v1Err.Code)
+	}
+	var xmppErr *XmppError
+	if errors.As(err, &xmppErr) {
+		switch xmppErr.Code {
+		case XmppErrorServiceUnavailable, XmppErrorInternalServerError, XmppErrorConnectionDraining,
+			XmppErrorDeviceMessageRateExceeded, XmppErrorTopicsMessageRateExceeded:
+			return true
+		}
+	}
+	return false
+}
+
+// IsNotRegistered checks if the error means that the registration token is no longer valid,
+// e.g. the app was uninstalled. The token should be deleted.
+func IsNotRegistered(err error) bool {
+	var resultErr ResultError
+	if errors.As(err, &resultErr) {
+		return resultErr.Code == ErrorNotRegistered
+	}
+	var v1Err *V1Error
+	if errors.As(err, &v1Err) {
+		return v1Err.ErrorCode() == V1ErrorUnregistered
+	}
+	var xmppErr *XmppError
+	if errors.As(err, &xmppErr) {
+		return xmppErr.Code == XmppErrorDeviceUnregistered
+	}
+	return false
+}
+
+// IsInvalidToken checks if the error means that the registration token is malformed,
+// missing or belongs to a different sender. The token should not be used again.
+func IsInvalidToken(err error) bool {
+	var resultErr ResultError
+	if errors.As(err, &resultErr) {
+		switch resultErr.Code {
+		case ErrorInvalidRegistration, ErrorMissingRegistration, ErrorMismatchSenderId:
+			return true
+		}
+		return false
+	}
+	var v1Err *V1Error
+	if errors.As(err, &v1Err) {
+		return v1Err.ErrorCode() == V1ErrorSenderIdMismatch
+	}
+	var xmppErr *XmppError
+	if errors.As(err, &xmppErr) {
+		return xmppErr.Code == XmppErrorBadRegistration
+	}
+	return false
+}
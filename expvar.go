@@ -0,0 +1,62 @@
+package fcm
+
+import (
+	"expvar"
+	"sync"
+)
+
+// Keys of the counters published with WithExpvar.
+const (
+	// Number of HTTP requests sent to FCM, including retries.
+	ExpvarSent = "sent"
+	// Number of requests accepted by FCM. Individual tokens of an accepted request may still fail.
+	ExpvarSuccess = "success"
+	// Number of requests failed with an HTTP or network error.
+	ExpvarFailure = "failure"
+	// Number of retried requests.
+	ExpvarRetries = "retries"
+	// Total size of request payloads in bytes.
+	ExpvarBytes = "bytes"
+)
+
+// WithExpvar publishes counters of the client as an expvar.Map with the given name, e.g.
+// "fcm", so they are shown at /debug/vars. Clients created with the same name share
+// the counters. It panics if the name is already used by an expvar which is not a map.
+func WithExpvar(name string) Option {
+	return func(o *clientOptions) {
+		o.expvarName = name
+	}
+}
+
+// Guards publishing of expvar maps by concurrently created clients.
+var expvarLock sync.Mutex
+
+// expvarMap returns the published map with the given name or publishes a new one.
+func expvarMap(name string) *expvar.Map {
+	expvarLock.Lock()
+	defer expvarLock.Unlock()
+
+	if v := expvar.Get(name); v != nil {
+		return v.(*expvar.Map)
+	}
+	m := expvar.NewMap(name)
+	// Make all counters visible from the start.
+	for _, key := range []string{ExpvarSent, ExpvarSuccess, ExpvarFailure, ExpvarRetries, ExpvarBytes} {
+		m.Add(key, 0)
+	}
+	return m
+}
+
+// countRequest updates the expvar counters after a request to FCM.
+func (c *Client) countRequest(size int, err error) {
+	if c.stats == nil {
+		return
+	}
+	c.stats.Add(ExpvarSent, 1)
+	c.stats.Add(ExpvarBytes, int64(size))
+	if err != nil {
+		c.stats.Add(ExpvarFailure, 1)
+	} else {
+		c.stats.Add(ExpvarSuccess, 1)
+	}
+}
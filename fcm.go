@@ -1,23 +1,39 @@
 package fcm
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"expvar"
+	"fmt"
+	"io"
 	"io/ioutil"
-	"net"
 	"net/http"
+	"net/http/httptrace"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
 	// FCM server address
-	serverURL = "https://fcm.googleapis.com/fcm/send"
+	fcmBaseURL = "https://fcm.googleapis.com"
+	// Instance ID server address
+	iidBaseURL = "https://iid.googleapis.com"
+
+	// Legacy HTTP API endpoint
+	legacySendPath = "/fcm/send"
+	// HTTP v1 API endpoint, %s is replaced with the project ID.
+	v1SendPath = "/v1/projects/%s/messages:send"
 
 	// Network timeout for connecting to the server. Not setting it may create a large
 	// pool of waiting connectins in case of network problems.
-	connectionTimeout = 5 * time.Second
+	defaultConnectionTimeout = 5 * time.Second
+	// Timeout for receiving response headers after the request is sent. Otherwise
+	// a server which accepts the request but never responds blocks the caller forever.
+	defaultResponseHeaderTimeout = 30 * time.Second
 
 	PriorityHigh   = "high"
 	PriorityNormal = "normal"
@@ -41,26 +57,65 @@ const (
 
 // HttpMessage is an FCM HTTP request message
 type HttpMessage struct {
-	To                    string        `json:"to,omitempty"`
-	RegistrationIds       []string      `json:"registration_ids,omitempty"`
-	Condition             string        `json:"condition,omitempty"`
-	CollapseKey           string        `json:"collapse_key,omitempty"`
-	Priority              string        `json:"priority,omitempty"`
-	ContentAvailable      bool          `json:"content_available,omitempty"`
+	To               string   `json:"to,omitempty"`
+	RegistrationIds  []string `json:"registration_ids,omitempty"`
+	Condition        string   `json:"condition,omitempty"`
+	CollapseKey      string   `json:"collapse_key,omitempty"`
+	Priority         string   `json:"priority,omitempty"`
+	ContentAvailable bool     `json:"content_available,omitempty"`
+	// MutableContent lets the iOS Notification Service Extension modify the notification
+	// before it's displayed, e.g. to download an image attachment or decrypt the content.
+	MutableContent        bool          `json:"mutable_content,omitempty"`
 	TimeToLive            *uint         `json:"time_to_live,omitempty"`
 	RestrictedPackageName string        `json:"restricted_package_name,omitempty"`
 	DryRun                bool          `json:"dry_run,omitempty"`
 	Data                  interface{}   `json:"data,omitempty"`
 	Notification          *Notification `json:"notification,omitempty"`
+
+	// Platform-specific options
+	Android *AndroidConfig `json:"android,omitempty"`
+	Apns    *ApnsConfig    `json:"apns,omitempty"`
+	Webpush *WebpushConfig `json:"webpush,omitempty"`
+
+	// IdempotencyKey identifies the message for suppressing duplicate sends, see WithDedup.
+	// It's not sent to FCM.
+	IdempotencyKey string `json:"-"`
+}
+
+// SetTTL sets how long the message is kept in FCM storage if the device is offline, rounded
+// down to seconds. The ttl must be between 0 and MaxTimeToLive. Zero means "now or never":
+// the message is discarded if it cannot be delivered immediately.
+func (msg *HttpMessage) SetTTL(ttl time.Duration) error {
+	if ttl < 0 || ttl > MaxTimeToLive {
+		return &ValidationError{Field: "time_to_live", Reason: "must be between 0 and 4 weeks"}
+	}
+	seconds := uint(ttl / time.Second)
+	msg.TimeToLive = &seconds
+	return nil
+}
+
+// TTL returns the time to live of the message and false if it's not set, i.e. FCM default
+// of 4 weeks applies.
+func (msg *HttpMessage) TTL() (time.Duration, bool) {
+	if msg.TimeToLive == nil {
+		return 0, false
+	}
+	return time.Duration(*msg.TimeToLive) * time.Second, true
 }
 
 // HttpResponse is an FCM response message
 type HttpResponse struct {
-	MulticastId  int      `json:"multicast_id"`
+	MulticastId  int64    `json:"multicast_id"`
 	Success      int      `json:"success"`
 	Fail         int      `json:"failure"`
 	CanonicalIds int      `json:"canonical_ids"`
 	Results      []Result `json:"results,omitempty"`
+
+	// RetryAfter is the value of the Retry-After header of this response, zero if the header is missing.
+	RetryAfter time.Duration `json:"-"`
+
+	// Registration tokens the message was sent to, in the order of Results.
+	tokens []string
 }
 
 type Result struct {
@@ -71,125 +126,662 @@ type Result struct {
 
 // Notification notification message structure
 type Notification struct {
-	Title        string `json:"title,omitempty"`
-	Body         string `json:"body,omitempty"`
-	Sound        string `json:"sound,omitempty"`
-	ClickAction  string `json:"click_action,omitempty"`
-	BodyLocKey   string `json:"body_loc_key,omitempty"`
-	BodyLocArgs  string `json:"body_loc_args,omitempty"`
-	TitleLocKey  string `json:"title_loc_key,omitempty"`
-	TitleLocArgs string `json:"title_loc_args,omitempty"`
+	Title        string   `json:"title,omitempty"`
+	Body         string   `json:"body,omitempty"`
+	Sound        string   `json:"sound,omitempty"`
+	ClickAction  string   `json:"click_action,omitempty"`
+	BodyLocKey   string   `json:"body_loc_key,omitempty"`
+	BodyLocArgs  []string `json:"body_loc_args,omitempty"`
+	TitleLocKey  string   `json:"title_loc_key,omitempty"`
+	TitleLocArgs []string `json:"title_loc_args,omitempty"`
+	// Image is URL of an image to be displayed in the notification.
+	Image string `json:"image,omitempty"`
 
 	// Android only
-	Icon  string `json:"icon,omitempty"`
-	Tag   string `json:"tag,omitempty"`
-	Color string `json:"color,omitempty"`
+	Icon             string `json:"icon,omitempty"`
+	Tag              string `json:"tag,omitempty"`
+	Color            string `json:"color,omitempty"`
+	AndroidChannelId string `json:"android_channel_id,omitempty"`
 
 	// iOS only
-	Badge string `json:"badge,omitempty"`
+	Subtitle string `json:"subtitle,omitempty"`
+	// Badge is the number shown on the app icon, nil to leave it unchanged.
+	// Use BadgeCount or ClearBadge to set it.
+	Badge *Badge `json:"badge,omitempty"`
 }
 
+// Badge is the number shown on the app icon. It's sent as a string as expected by FCM legacy API.
+type Badge int
+
+// BadgeCount returns a badge value to use in Notification.
+func BadgeCount(count int) *Badge {
+	b := Badge(count)
+	return &b
+}
+
+// ClearBadge returns a badge value which removes the badge from the app icon.
+func ClearBadge() *Badge {
+	return BadgeCount(0)
+}
+
+// MarshalJSON encodes the badge as a string.
+func (b Badge) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strconv.Itoa(int(b)))
+}
+
+// UnmarshalJSON decodes the badge from either a string or a number.
+func (b *Badge) UnmarshalJSON(data []byte) error {
+	var count int
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		if s == "" {
+			*b = 0
+			return nil
+		}
+		var err error
+		if count, err = strconv.Atoi(s); err != nil {
+			return err
+		}
+	} else if err := json.Unmarshal(data, &count); err != nil {
+		return err
+	}
+	*b = Badge(count)
+	return nil
+}
+
+// UnmarshalJSON decodes the notification. For compatibility with messages serialized when
+// BodyLocArgs and TitleLocArgs were strings, the arguments may be a JSON-encoded array
+// inside a string, e.g. "[\"a\", \"b\"]".
+func (n *Notification) UnmarshalJSON(data []byte) error {
+	type notification Notification
+	var aux struct {
+		notification
+		BodyLocArgs  json.RawMessage `json:"body_loc_args"`
+		TitleLocArgs json.RawMessage `json:"title_loc_args"`
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	*n = Notification(aux.notification)
+	var err error
+	if n.BodyLocArgs, err = decodeLocArgs(aux.BodyLocArgs); err != nil {
+		return err
+	}
+	n.TitleLocArgs, err = decodeLocArgs(aux.TitleLocArgs)
+	return err
+}
+
+// decodeLocArgs decodes localization arguments given either as an array or as a string
+// containing a JSON-encoded array.
+func decodeLocArgs(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	if raw[0] == '"' {
+		var encoded string
+		if err := json.Unmarshal(raw, &encoded); err != nil {
+			return nil, err
+		}
+		if encoded == "" {
+			return nil, nil
+		}
+		raw = json.RawMessage(encoded)
+	}
+	var args []string
+	if err := json.Unmarshal(raw, &args); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+// Client is an FCM client. It's safe for concurrent use by multiple go routines: all fields
+// are set by the constructor and never modified afterwards except retryAfter which is
+// accessed atomically, the shutdown state guarded by closeLock and topic queues guarded
+// by topicLock.
 type Client struct {
 	apiKey     string
-	connection *http.Transport
-	retryAfter string
+	connection http.RoundTripper
+
+	// URL of the legacy HTTP API endpoint.
+	endpoint string
+	// Base URLs of the FCM and Instance ID servers.
+	fcmURL string
+	iidURL string
+
+	// Limit on the total time of one request, zero for no limit.
+	timeout time.Duration
+
+	// Optional observer of sends.
+	observer Observer
+	// Optional structured logger.
+	logger Logger
+	// Optional tracer of operations.
+	tracer Tracer
+	// Optional expvar counters.
+	stats *expvar.Map
+	// Encode messages while sending instead of buffering them.
+	streamBody bool
+	// Compress request bodies.
+	gzip bool
+	// Optional trace hooks of all requests.
+	clientTrace *httptrace.ClientTrace
+	// Custom headers of all requests.
+	headers   http.Header
+	userAgent string
+
+	// Retry policy, nil if retrying is disabled, and the limit of the total time of the send.
+	retry       RetryPolicy
+	retryBudget time.Duration
+	// Network errors are retried.
+	atLeastOnce bool
+	// Optional circuit breaker.
+	breaker *circuitBreaker
+	// Optional limiter of the request rate and its adaptive settings.
+	limiter      *rateLimiter
+	adaptiveRate *AdaptiveRateConfig
+	// Optional per-device throttling.
+	deviceThrottle *DeviceThrottleConfig
+	// Optional per-topic throttling and the queues of topic sends.
+	topicThrottle *TopicThrottleConfig
+	topicLock     sync.Mutex
+	topicQueues   map[string]*topicQueue
+
+	// Check registration tokens with ValidateToken before sending.
+	validateTokens bool
+
+	// Optional callback for canonical registration IDs.
+	onCanonicalID func(oldToken, newToken string)
+	// Optional callback for tokens which are no longer valid.
+	onInvalidToken func(token, reason string)
+	onDeadLetter   func(msg *HttpMessage, err error)
+	onDeadLetterV1 func(msg *Message, err error)
+
+	// Maximum number of SendMulticast chunks sent at the same time, zero for no limit.
+	multicastConcurrency int
+
+	// Queue of PostHttp requests if the worker pool is enabled, nil otherwise.
+	postQueue      chan postJob
+	asyncWorkers   int
+	asyncQueueSize int
+	// Queues of Enqueue messages if enabled with WithQueue, nil otherwise.
+	queueHigh   chan *queueItem
+	queue       chan *queueItem
+	queueConfig *QueueConfig
+	// Queued messages registered for coalescing by their coalesce key.
+	coalesceLock sync.Mutex
+	coalesced    map[string]*queueItem
+	// Idempotency keys of recent sends if enabled with WithDedup, nil otherwise.
+	dedup *dedupCache
+	// Scheduled messages, created on the first Schedule call.
+	schedulerOnce sync.Once
+	scheduler     *scheduler
+
+	// Retry-After header (string) of the most recent response.
+	retryAfter atomic.Value
+
+	// Shutdown state: closing is closed first by Close, it releases sends blocked on a full
+	// queue; then closed is set under closeLock. closeStarted is set atomically by the first
+	// Close.
+	closeLock    sync.RWMutex
+	closed       bool
+	closing      chan struct{}
+	closeStarted int32
+	// In-flight sends.
+	inflight sync.WaitGroup
+
+	// HTTP v1 API only: project ID and the source of OAuth2 access tokens.
+	projectID string
+	tokens    TokenSource
 }
 
 // NewClient returns an FCM client. The client is expected to be
 // long-lived. It maintains an internal pool of HTTP connections.
 // Multiple sumultaneous Send requests can be issued on the same client.
-func NewClient(apikey string) *Client {
-	return &Client{
-		apiKey: "key=" + apikey,
-		connection: &http.Transport{
-			Dial: (&net.Dialer{
-				Timeout: connectionTimeout,
-			}).Dial,
-			TLSHandshakeTimeout: connectionTimeout,
-		},
+// The client can be customized with options.
+func NewClient(apikey string, opts ...Option) *Client {
+	c := newClient(opts)
+	c.apiKey = "key=" + apikey
+	c.start()
+	return c
+}
+
+// NewClientWithOptions is the same as NewClient.
+func NewClientWithOptions(apikey string, opts ...Option) *Client {
+	return NewClient(apikey, opts...)
+}
+
+// NewClientV1 returns an FCM client which uses FCM HTTP v1 API. The client authenticates
+// with short-lived OAuth2 access tokens minted from the service account JSON key.
+// The tokens are cached and refreshed automatically before they expire. If projectID is
+// empty, the project ID from the service account key is used.
+// Use SendV1 to send messages with such client.
+func NewClientV1(serviceAccountJSON []byte, projectID string, opts ...Option) (*Client, error) {
+	c := newClient(opts)
+	tokens, account, err := newServiceAccountTokens(serviceAccountJSON, c.connection)
+	if err != nil {
+		return nil, err
+	}
+	if projectID == "" {
+		projectID = account.ProjectID
 	}
+	if projectID == "" {
+		return nil, errors.New("fcm: project ID is not specified")
+	}
+
+	c.projectID = projectID
+	c.tokens = tokens
+	c.start()
+	return c, nil
+}
+
+// NewClientWithTokenSource returns an FCM client which uses FCM HTTP v1 API with access tokens
+// obtained from the given TokenSource.
+func NewClientWithTokenSource(tokens TokenSource, projectID string, opts ...Option) *Client {
+	c := newClient(opts)
+	c.projectID = projectID
+	c.tokens = tokens
+	c.start()
+	return c
 }
 
 // SendHttp is a blocking call to send an HTTP message to FCM server.
 // Multiple Send requests can be issued simultaneously on the same
-// Client.
+// Client. If the server responds with HTTP status other than 200 OK, the error is *HttpError.
 func (c *Client) SendHttp(msg *HttpMessage) (*HttpResponse, error) {
+	return c.SendHttpContext(context.Background(), msg)
+}
 
-	// Encode message to JSON
-	var rw bytes.Buffer
-	encoder := json.NewEncoder(&rw)
-	err := encoder.Encode(msg)
-	if err != nil {
+// SendHttpContext is the same as SendHttp but the request is bound to the given context.
+// If the context is cancelled or its deadline expires before the response is fully read,
+// the call returns promptly with an error which wraps ctx.Err(), i.e.
+// errors.Is(err, context.Canceled) or errors.Is(err, context.DeadlineExceeded) is true.
+func (c *Client) SendHttpContext(ctx context.Context, msg *HttpMessage) (*HttpResponse, error) {
+	return c.sendMessage(ctx, msg, nil)
+}
+
+// SendResult is the response to the message sent with SendWithMeta together with details
+// of the send.
+type SendResult struct {
+	// Response is nil if the send failed.
+	Response *HttpResponse
+	// Duration is the total time of the send including all attempts and delays between them.
+	Duration time.Duration
+	// StatusCode is the HTTP status of the last response, zero if no response was received.
+	StatusCode int
+	// Attempts is the number of requests made, more than one if the request was retried.
+	Attempts int
+	// RetryAfter is the raw value of the Retry-After header of the last response.
+	RetryAfter string
+}
+
+// SendWithMeta is the same as SendHttpContext but it also reports the duration, HTTP status
+// and number of attempts of the send. The result is returned even if the send fails,
+// it's nil only if the message could not be sent at all, e.g. it's invalid. Attempts is
+// zero if all tokens were collapsed by WithDeviceThrottle.
+func (c *Client) SendWithMeta(ctx context.Context, msg *HttpMessage) (*SendResult, error) {
+	result := &SendResult{}
+	resp, err := c.sendMessage(ctx, msg, result)
+	if resp == nil && result.Attempts == 0 {
 		return nil, err
 	}
+	result.Response = resp
+	return result, err
+}
 
-	// Format request
-	req, err := http.NewRequest(http.MethodPost, serverURL, &rw)
-	if err != nil {
+// sendMessage sends the message. Details of the send are saved to the result, if not nil.
+func (c *Client) sendMessage(ctx context.Context, msg *HttpMessage, result *SendResult) (*HttpResponse, error) {
+	if err := c.startSend(); err != nil {
 		return nil, err
 	}
-	req.Header.Add(http.CanonicalHeaderKey("Content-Type"), "application/json")
-	req.Header.Add(http.CanonicalHeaderKey("Authorization"), c.apiKey)
+	defer c.endSend()
 
-	//debug, err := httputil.DumpRequest(req, true)
-	//log.Printf("request: '%s'", string(debug))
+	if err := c.checkMessage(msg); err != nil {
+		return nil, err
+	}
+	resp, err := c.deliver(ctx, msg, result)
+	c.deadLetter(msg, err)
+	return resp, err
+}
 
-	// Call the server, issue HTTP POST, wait for response
-	httpResp, err := c.connection.RoundTrip(req)
-	if httpResp != nil {
-		defer httpResp.Body.Close()
+// deliver sends the validated message registered as in-flight by the caller.
+func (c *Client) deliver(ctx context.Context, msg *HttpMessage, result *SendResult) (resp *HttpResponse, err error) {
+	if !msg.DryRun {
+		sent, claimErr := c.claimKey(msg.IdempotencyKey)
+		if claimErr != nil {
+			return nil, claimErr
+		}
+		defer func() { sent(err) }()
 	}
+	tokens := messageTokens(msg)
+
+	send, collapsed := msg, []string(nil)
+	if !msg.DryRun {
+		if send, collapsed, err = c.throttleDevices(ctx, msg); err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(msg.To, topicPrefix) {
+			if err = c.throttleTopic(ctx, msg.To); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if send == nil {
+		// All tokens are throttled, nothing to send.
+		resp := collapsedResponse(nil, tokens, collapsed)
+		resp.tokens = tokens
+		return resp, nil
+	}
+
+	payload, err := c.encodeBody(send)
 	if err != nil {
 		return nil, err
 	}
+	defer payload.release()
 
-	// debug, err := httputil.DumpResponse(httpResp, true)
-	// log.Printf("response: '%s'", string(debug))
+	// Retries of the failed tokens share the attempts and the time budget of the request.
+	var state retryState
+	info := sendInfo{tokens: len(tokens) - len(collapsed), priority: msg.Priority}
+	resp, err = c.sendPayload(ctx, payload, info, result, &state)
+	if err == nil && resp != nil {
+		c.retryFailedTokens(ctx, send, resp, result, &state)
+	}
+	if resp != nil {
+		if len(collapsed) > 0 {
+			resp = collapsedResponse(resp, tokens, collapsed)
+		}
+		resp.tokens = tokens
+		c.handleResults(resp)
+	}
+	return resp, err
+}
 
-	// Read response completely and close the body to make
-	// the underlying connection reusable.
-	body, err := ioutil.ReadAll(httpResp.Body)
+// SendDryRun sends a copy of the message with DryRun set: FCM validates the message and
+// the tokens without delivering anything to the devices. Like SendMulticast, it accepts any
+// number of tokens. Use HttpResponse.TokensToRemove or Analyze to find out which tokens
+// are no longer valid.
+func (c *Client) SendDryRun(ctx context.Context, msg *HttpMessage) (*HttpResponse, error) {
+	dryRun := *msg
+	dryRun.DryRun = true
+	resp, _, err := c.sendMulticast(ctx, &dryRun)
+	return resp, err
+}
+
+// messageTokens returns the registration tokens the message is addressed to, nil for
+// topics and conditions.
+func messageTokens(msg *HttpMessage) []string {
+	if len(msg.RegistrationIds) > 0 {
+		return msg.RegistrationIds
+	}
+	if msg.To != "" && !strings.HasPrefix(msg.To, topicPrefix) {
+		return []string{msg.To}
+	}
+	return nil
+}
+
+// checkMessage validates the message and its tokens.
+func (c *Client) checkMessage(msg *HttpMessage) error {
+	if err := msg.Validate(); err != nil {
+		return err
+	}
+	if msg.To != "" && !strings.HasPrefix(msg.To, topicPrefix) {
+		if err := c.checkTokens(msg.To); err != nil {
+			return err
+		}
+	}
+	return c.checkTokens(msg.RegistrationIds...)
+}
+
+// sendInfo describes the message for logs and traces.
+type sendInfo struct {
+	// Number of registration tokens.
+	tokens   int
+	priority string
+}
+
+// sendPayload sends JSON-encoded message to the server and decodes the response.
+// The request is retried if the client is configured to do so. Details of the send
+// are saved to the result, if not nil. The progress of retries is kept in the state.
+func (c *Client) sendPayload(ctx context.Context, payload requestBody, info sendInfo,
+	result *SendResult, state *retryState) (*HttpResponse, error) {
+
+	ctx, end := c.startSpan(ctx, "fcm.SendHttp",
+		Attribute{Key: AttributePriority, Value: info.priority},
+		Attribute{Key: AttributeTokens, Value: info.tokens})
+
+	if c.gzip {
+		payload = &gzipBody{payload: payload}
+	}
+
+	start := time.Now()
+	var last attempt
+	c.retryLoop(ctx, state, func() (bool, time.Duration, error) {
+		last = c.post(ctx, payload)
+		return c.retryable(ctx, &last), parseRetryAfter(last.retryAfter), last.failure()
+	})
+	end(last.statusCode, last.err)
+
+	if result != nil {
+		result.Duration = time.Since(start)
+		result.StatusCode = last.statusCode
+		result.Attempts = state.attempts
+		result.RetryAfter = last.retryAfter
+	}
+
+	if c.logger != nil {
+		if last.err != nil {
+			c.logger.Error("fcm: send failed", "tokens", info.tokens, "status", last.statusCode, "error", last.err)
+		} else {
+			c.logger.Debug("fcm: send completed", "tokens", info.tokens,
+				"success", last.resp.Success, "failure", last.resp.Fail)
+		}
+	}
+	return last.resp, last.err
+}
+
+// attempt is the outcome of a single request to the legacy HTTP API.
+type attempt struct {
+	resp *HttpResponse
+	// HTTP status code, zero if no response was received.
+	statusCode int
+	// Raw value of the Retry-After header.
+	retryAfter string
+	err        error
+}
+
+// retryable checks if the request has failed with a transient error: either it has failed
+// with a retryable error, or the message could not be delivered to any recipient
+// because of Unavailable or InternalServerError.
+func (c *Client) retryable(ctx context.Context, a *attempt) bool {
+	if a.err != nil {
+		return c.retryableError(ctx, a.statusCode, a.err)
+	}
+	if a.resp == nil || a.resp.Success > 0 || len(a.resp.Results) == 0 {
+		return false
+	}
+	for _, r := range a.resp.Results {
+		if r.Error != ErrorUnavailable && r.Error != ErrorInternalServerError {
+			return false
+		}
+	}
+	return true
+}
+
+// failure returns the error of the attempt. If no recipient has received the message, it's
+// the ResultError of the first recipient.
+func (a *attempt) failure() error {
+	if a.err != nil || a.resp == nil || a.resp.Success > 0 || len(a.resp.Results) == 0 {
+		return a.err
+	}
+	return ResultError{Code: a.resp.Results[0].Error}
+}
+
+// post issues one HTTP POST with the message and decodes the response.
+func (c *Client) post(ctx context.Context, payload requestBody) (a attempt) {
+	if err := c.waitTurn(ctx); err != nil {
+		return attempt{err: err}
+	}
+	done, err := c.allowRequest()
 	if err != nil {
-		return nil, err
+		return attempt{err: err}
+	}
+	defer func() {
+		done(a.statusCode, a.err)
+		c.adaptRate(a.statusCode, a.resp)
+	}()
+
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	start := time.Now()
+	defer func() {
+		if c.observer != nil {
+			c.observer.OnSend(time.Since(start), a.statusCode, a.resp, a.err)
+		}
+		c.logRequest("legacy", payload.size(), a.statusCode, time.Since(start), a.err)
+		c.countRequest(payload.size(), a.err)
+	}()
+
+	// Format request
+	req, err := http.NewRequest(http.MethodPost, c.endpoint, nil)
+	if err != nil {
+		return attempt{err: err}
+	}
+	req = req.WithContext(c.withClientTrace(ctx))
+	req = c.setBody(req, payload)
+	req.Header.Add(http.CanonicalHeaderKey("Content-Type"), "application/json")
+	req.Header.Add(http.CanonicalHeaderKey("Authorization"), c.apiKey)
+
+	// Call the server, issue HTTP POST, wait for response
+	c.addHeaders(req)
+	httpResp, body, err := roundTrip(c.connection, req)
+	if err != nil {
+		return attempt{err: err}
 	}
 
+	// Get value of retry-after if present
+	retryAfter := httpResp.Header.Get(http.CanonicalHeaderKey("Retry-After"))
+
 	if httpResp.StatusCode != http.StatusOK {
 		// Assuming non-JSON response
-		return nil, errors.New(httpResp.Status + ": " + string(body))
+		return attempt{
+			statusCode: httpResp.StatusCode,
+			retryAfter: retryAfter,
+			err:        newHttpError(httpResp, body),
+		}
 	}
 
 	// Decode JSON response
 	var response HttpResponse
 	err = json.Unmarshal(body, &response)
 
-	// Get value of retry-after if present
 	if err == nil {
-		c.retryAfter = httpResp.Header.Get(http.CanonicalHeaderKey("Retry-After"))
+		response.RetryAfter = parseRetryAfter(retryAfter)
+		c.retryAfter.Store(retryAfter)
 	}
 
-	return &response, err
+	return attempt{resp: &response, statusCode: httpResp.StatusCode, retryAfter: retryAfter, err: err}
+}
+
+// setBody sets the body of the request to the payload, compressed if configured.
+func (c *Client) setBody(req *http.Request, payload requestBody) *http.Request {
+	req.Body = payload.body()
+	req.GetBody = func() (io.ReadCloser, error) { return payload.body(), nil }
+	req.ContentLength = payload.contentLength()
+	inner := payload
+	if g, ok := payload.(*gzipBody); ok {
+		req.Header.Set(http.CanonicalHeaderKey("Content-Encoding"), "gzip")
+		inner = g.payload
+	}
+	if _, ok := inner.(*jsonStream); ok {
+		// Not encoded again only to be dumped by WithDebugLogger.
+		req = req.WithContext(context.WithValue(req.Context(), streamedBodyKey{}, true))
+	}
+	return req
+}
+
+// withTimeout limits the context with the request timeout of the client, if any.
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout > 0 {
+		return context.WithTimeout(ctx, c.timeout)
+	}
+	return ctx, func() {}
+}
+
+// authorization returns the value of the Authorization header: the server key for
+// legacy API clients or the OAuth2 access token for HTTP v1 API clients.
+func (c *Client) authorization(ctx context.Context) (string, error) {
+	if c.tokens != nil {
+		token, err := c.tokens.Token(ctx)
+		if err != nil {
+			return "", err
+		}
+		return "Bearer " + token, nil
+	}
+	return c.apiKey, nil
+}
+
+// roundTrip issues the request and reads the response body completely.
+func roundTrip(connection http.RoundTripper, req *http.Request) (*http.Response, []byte, error) {
+	ctx := req.Context()
+	httpResp, err := connection.RoundTrip(req)
+	if httpResp != nil {
+		defer httpResp.Body.Close()
+	}
+	if err != nil {
+		return nil, nil, contextError(ctx, err)
+	}
+
+	// Read response completely and close the body to make
+	// the underlying connection reusable.
+	body, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, nil, contextError(ctx, err)
+	}
+	return httpResp, body, nil
+}
+
+// contextError wraps the context error if the request failed because the context
+// was cancelled or timed out. Otherwise the original error is returned unchanged.
+func contextError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("fcm: request aborted: %w", ctxErr)
+	}
+	return err
 }
 
 // GetRetryAfter returns the number fo seconds to wait before retrying Send in case the previous
-// Send has failed.
+// Send has failed. If multiple Send requests are issued simultaneously, the value comes
+// from the most recently completed one.
+//
+// Deprecated: use HttpResponse.RetryAfter of a specific response or RetryAfter(err) of
+// a failed request instead.
 func (c *Client) GetRetryAfter() uint {
-	if c.retryAfter == "" {
+	retryAfter, _ := c.retryAfter.Load().(string)
+	return uint(parseRetryAfter(retryAfter) / time.Second)
+}
+
+// parseRetryAfter parses the value of the Retry-After header which is either
+// a number of seconds or an HTTP date.
+func parseRetryAfter(retryAfter string) time.Duration {
+	if retryAfter == "" {
 		return 0
 	}
-	if ra, err := strconv.Atoi(c.retryAfter); err == nil {
-		return uint(ra)
+	if ra, err := strconv.Atoi(retryAfter); err == nil {
+		if ra < 0 {
+			return 0
+		}
+		return time.Duration(ra) * time.Second
 	}
-	if ts, err := http.ParseTime(c.retryAfter); err == nil {
-		sec := ts.Sub(time.Now()).Seconds()
-		if sec < 0 {
+	if ts, err := http.ParseTime(retryAfter); err == nil {
+		d := ts.Sub(time.Now())
+		if d < 0 {
 			return 0
 		}
-		return uint(sec)
+		return d
 	}
 	return 0
 }
-
-// PostHttp is a non-blocking version of Send. Not implemented yet.
-func (c *Client) PostHttp(msg *HttpMessage) (<-chan *HttpResponse, error) {
-	return nil, errors.New("Not implmented")
-}
@@ -0,0 +1,94 @@
+package fcm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newRetryAfterServer returns a server which accepts legacy HTTP API messages sent to a
+// token "tN" and responds with "Retry-After: N".
+func newRetryAfterServer(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg HttpMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Retry-After", strings.TrimPrefix(msg.To, "t"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"multicast_id":1,"success":1,"results":[{"message_id":"0:1"}]}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSendHttpConcurrentRetryAfter(t *testing.T) {
+	srv := newRetryAfterServer(t)
+	c := NewClient("key", WithBaseURL(srv.URL))
+	defer c.Close(context.Background())
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 50; i++ {
+		wg.Add(1)
+		go func(seconds int) {
+			defer wg.Done()
+			resp, err := c.SendHttp(&HttpMessage{To: "t" + strconv.Itoa(seconds)})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if want := time.Duration(seconds) * time.Second; resp.RetryAfter != want {
+				t.Errorf("RetryAfter = %v, want %v", resp.RetryAfter, want)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestGetRetryAfterConcurrent(t *testing.T) {
+	srv := newRetryAfterServer(t)
+	c := NewClient("key", WithBaseURL(srv.URL))
+	defer c.Close(context.Background())
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 20; i++ {
+		wg.Add(2)
+		go func(seconds int) {
+			defer wg.Done()
+			if _, err := c.SendHttp(&HttpMessage{To: "t" + strconv.Itoa(seconds)}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			if ra := c.GetRetryAfter(); ra > 20 {
+				t.Errorf("GetRetryAfter = %d, want at most 20", ra)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if ra := c.GetRetryAfter(); ra < 1 || ra > 20 {
+		t.Errorf("GetRetryAfter = %d, want the value of one of the responses", ra)
+	}
+}
+
+func TestHttpResponseLargeMulticastId(t *testing.T) {
+	// 2^53 + 1 can't be represented exactly as float64.
+	const id = int64(1)<<53 + 1
+	var resp HttpResponse
+	data := `{"multicast_id":` + strconv.FormatInt(id, 10) + `,"success":1,"results":[{"message_id":"0:1"}]}`
+	if err := json.Unmarshal([]byte(data), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.MulticastId != id {
+		t.Errorf("MulticastId = %d, want %d", resp.MulticastId, id)
+	}
+}
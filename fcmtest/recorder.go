@@ -0,0 +1,88 @@
+package fcmtest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/tinode/fcm"
+)
+
+// RecordedMessage is a message captured by RecorderClient.
+type RecordedMessage struct {
+	Message *fcm.HttpMessage
+	// Time when the message was sent.
+	Time time.Time
+}
+
+// RecorderClient is an fcm.Sender which records messages instead of sending them. By default
+// every message is reported as successfully delivered to every token. It's safe to use from
+// multiple go routines.
+type RecorderClient struct {
+	// Respond, if set, produces the response to the message instead of the default one.
+	Respond func(msg *fcm.HttpMessage) (*fcm.HttpResponse, error)
+
+	mu       sync.Mutex
+	messages []RecordedMessage
+}
+
+var _ fcm.Sender = (*RecorderClient)(nil)
+
+// NewRecorderClient returns a new RecorderClient.
+func NewRecorderClient() *RecorderClient {
+	return &RecorderClient{}
+}
+
+// SendHttpContext records a copy of the message and returns the response.
+func (r *RecorderClient) SendHttpContext(ctx context.Context, msg *fcm.HttpMessage) (*fcm.HttpResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := msg.Validate(); err != nil {
+		return nil, err
+	}
+
+	copied := *msg
+	r.mu.Lock()
+	r.messages = append(r.messages, RecordedMessage{Message: &copied, Time: time.Now()})
+	respond := r.Respond
+	r.mu.Unlock()
+
+	if respond != nil {
+		return respond(msg)
+	}
+
+	count := len(msg.RegistrationIds)
+	if count == 0 {
+		count = 1
+	}
+	resp := &fcm.HttpResponse{MulticastId: 1, Success: count}
+	for i := 0; i < count; i++ {
+		resp.Results = append(resp.Results, fcm.Result{MessageId: "0:recorded"})
+	}
+	return resp, nil
+}
+
+// Messages returns the recorded messages in the order they were sent.
+func (r *RecorderClient) Messages() []RecordedMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RecordedMessage(nil), r.messages...)
+}
+
+// Last returns the most recently recorded message, nil if none.
+func (r *RecorderClient) Last() *fcm.HttpMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.messages) == 0 {
+		return nil
+	}
+	return r.messages[len(r.messages)-1].Message
+}
+
+// Reset discards the recorded messages.
+func (r *RecorderClient) Reset() {
+	r.mu.Lock()
+	r.messages = nil
+	r.mu.Unlock()
+}
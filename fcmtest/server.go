@@ -0,0 +1,355 @@
+// Package fcmtest provides an in-memory FCM server for testing code which uses package fcm.
+//
+//	server := fcmtest.NewServer()
+//	defer server.Close()
+//
+//	client := server.NewClient()
+//	resp, err := client.SendHttp(&fcm.HttpMessage{To: "token", Data: ...})
+package fcmtest
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tinode/fcm"
+)
+
+const (
+	legacySendPath = "/fcm/send"
+	v1PathPrefix   = "/v1/projects/"
+	v1PathSuffix   = "/messages:send"
+)
+
+// Server is a fake FCM server which accepts legacy HTTP API and HTTP v1 API messages.
+// By default every message is delivered successfully to every token. Errors and canonical IDs
+// can be scripted with FailRequest, SetTokenError and SetCanonicalID. It's safe to use from
+// multiple go routines.
+type Server struct {
+	// URL of the server, e.g. "http://127.0.0.1:12345".
+	URL string
+
+	server *httptest.Server
+
+	mu         sync.Mutex
+	nextID     int64
+	messages   []*fcm.HttpMessage
+	v1Messages []*fcm.Message
+	v1Raw      []json.RawMessage
+
+	// Scripted behavior.
+	requests     int
+	failures     map[int]Failure
+	tokenErrors  map[string]string
+	canonicalIDs map[string]string
+}
+
+// Failure is a scripted failure of the entire request, see FailRequest.
+type Failure struct {
+	// StatusCode is the HTTP status of the response, e.g. http.StatusServiceUnavailable.
+	StatusCode int
+	// RetryAfter is sent in the Retry-After header if not zero.
+	RetryAfter time.Duration
+	// Body of the response, the status text if empty.
+	Body string
+}
+
+// NewServer starts a new server. The caller should call Close when finished.
+func NewServer() *Server {
+	s := &Server{
+		nextID:       1,
+		failures:     make(map[int]Failure),
+		tokenErrors:  make(map[string]string),
+		canonicalIDs: make(map[string]string),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.server.URL
+	return s
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// NewClient returns a legacy API client which sends messages to this server. The options
+// are applied after the one pointing the client to the server.
+func (s *Server) NewClient(opts ...fcm.Option) *fcm.Client {
+	return fcm.NewClient("test-api-key", append([]fcm.Option{fcm.WithBaseURL(s.URL)}, opts...)...)
+}
+
+// NewClientV1 returns an HTTP v1 API client which sends messages to this server.
+func (s *Server) NewClientV1(projectID string, opts ...fcm.Option) *fcm.Client {
+	return fcm.NewClientWithTokenSource(staticToken("test-access-token"), projectID,
+		append([]fcm.Option{fcm.WithBaseURL(s.URL)}, opts...)...)
+}
+
+// FailRequest makes the n-th request to the server (counting from 1) fail with the given
+// response. Requests of all kinds are counted, including well-formed ones.
+func (s *Server) FailRequest(n int, failure Failure) {
+	s.mu.Lock()
+	s.failures[n] = failure
+	s.mu.Unlock()
+}
+
+// SetTokenError makes all messages sent to the token fail with the error code, one of
+// fcm.Error* constants, e.g. fcm.ErrorNotRegistered. HTTP v1 API messages to the token fail
+// with the equivalent V1Error. An empty code removes the error.
+func (s *Server) SetTokenError(token, code string) {
+	s.mu.Lock()
+	if code == "" {
+		delete(s.tokenErrors, token)
+	} else {
+		s.tokenErrors[token] = code
+	}
+	s.mu.Unlock()
+}
+
+// SetCanonicalID makes the server report canonicalID as the new registration ID of the token
+// in legacy API responses. An empty canonicalID removes the mapping.
+func (s *Server) SetCanonicalID(token, canonicalID string) {
+	s.mu.Lock()
+	if canonicalID == "" {
+		delete(s.canonicalIDs, token)
+	} else {
+		s.canonicalIDs[token] = canonicalID
+	}
+	s.mu.Unlock()
+}
+
+// Requests returns the number of requests received by the server.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// Messages returns the legacy API messages received by the server.
+func (s *Server) Messages() []*fcm.HttpMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*fcm.HttpMessage(nil), s.messages...)
+}
+
+// V1Messages returns the HTTP v1 API messages received by the server.
+func (s *Server) V1Messages() []*fcm.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*fcm.Message(nil), s.v1Messages...)
+}
+
+// V1RawMessages returns the JSON of the HTTP v1 API messages received by the server as
+// they were sent, including the keys fcm.Message has no fields for.
+func (s *Server) V1RawMessages() []json.RawMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]json.RawMessage(nil), s.v1Raw...)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		http.Error(w, "unsupported content type", http.StatusBadRequest)
+		return
+	}
+
+	reader := io.Reader(r.Body)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reader = zr
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.requests++
+	failure, failed := s.failures[s.requests]
+	s.mu.Unlock()
+	if failed {
+		if failure.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int((failure.RetryAfter+time.Second-1)/time.Second)))
+		}
+		if failure.Body == "" {
+			failure.Body = http.StatusText(failure.StatusCode)
+		}
+		w.WriteHeader(failure.StatusCode)
+		w.Write([]byte(failure.Body))
+		return
+	}
+
+	switch {
+	case r.URL.Path == legacySendPath:
+		s.serveLegacy(w, r, body)
+	case strings.HasPrefix(r.URL.Path, v1PathPrefix) && strings.HasSuffix(r.URL.Path, v1PathSuffix):
+		s.serveV1(w, r, body)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) serveLegacy(w http.ResponseWriter, r *http.Request, body []byte) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "key=") &&
+		!strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var msg fcm.HttpMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		http.Error(w, "JSON_PARSING_ERROR: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := msg.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tokens := msg.RegistrationIds
+	if len(tokens) == 0 {
+		tokens = []string{msg.To}
+	}
+
+	s.mu.Lock()
+	s.messages = append(s.messages, &msg)
+	resp := &fcm.HttpResponse{MulticastId: s.newID()}
+	for _, token := range tokens {
+		if code := s.tokenErrors[token]; code != "" {
+			resp.Results = append(resp.Results, fcm.Result{Error: code})
+			resp.Fail++
+			continue
+		}
+		result := fcm.Result{MessageId: "0:" + strconv.FormatInt(s.newID(), 10)}
+		if canonicalID := s.canonicalIDs[token]; canonicalID != "" {
+			result.RegistrationId = canonicalID
+			resp.CanonicalIds++
+		}
+		resp.Results = append(resp.Results, result)
+		resp.Success++
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, resp)
+}
+
+func (s *Server) serveV1(w http.ResponseWriter, r *http.Request, body []byte) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		writeV1Error(w, http.StatusUnauthorized, "UNAUTHENTICATED", "missing access token", "")
+		return
+	}
+
+	// Only the targets are validated, the message is recorded as sent.
+	var req struct {
+		Message json.RawMessage `json:"message"`
+	}
+	var dest struct {
+		Token     string `json:"token"`
+		Topic     string `json:"topic"`
+		Condition string `json:"condition"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil || len(req.Message) == 0 ||
+		json.Unmarshal(req.Message, &dest) != nil {
+		writeV1Error(w, http.StatusBadRequest, "INVALID_ARGUMENT", "invalid message", fcm.V1ErrorInvalidArgument)
+		return
+	}
+	msg := &fcm.Message{}
+	if err := json.Unmarshal(req.Message, msg); err != nil {
+		// Keep what could be decoded, V1RawMessages has the rest.
+		msg.Token, msg.Topic, msg.Condition = dest.Token, dest.Topic, dest.Condition
+	}
+	targets := 0
+	for _, target := range []string{dest.Token, dest.Topic, dest.Condition} {
+		if target != "" {
+			targets++
+		}
+	}
+	if targets != 1 {
+		writeV1Error(w, http.StatusBadRequest, "INVALID_ARGUMENT",
+			"exactly one of token, topic or condition must be set", fcm.V1ErrorInvalidArgument)
+		return
+	}
+
+	project := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, v1PathPrefix), v1PathSuffix)
+
+	s.mu.Lock()
+	s.v1Messages = append(s.v1Messages, msg)
+	s.v1Raw = append(s.v1Raw, req.Message)
+	code := s.tokenErrors[msg.Token]
+	if code != "" {
+		s.mu.Unlock()
+		status, v1Status, v1Code := v1Equivalent(code)
+		writeV1Error(w, status, v1Status, code, v1Code)
+		return
+	}
+	name := "projects/" + project + "/messages/" + strconv.FormatInt(s.newID(), 10)
+	s.mu.Unlock()
+
+	writeJSON(w, &fcm.V1Response{Name: name})
+}
+
+// newID returns a unique ID. Must be called with s.mu held.
+func (s *Server) newID() int64 {
+	id := s.nextID
+	s.nextID++
+	return id
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeV1Error(w http.ResponseWriter, code int, status, message, errorCode string) {
+	v1Err := &fcm.V1Error{Code: code, Status: status, Message: message}
+	if errorCode != "" {
+		v1Err.Details = []fcm.V1ErrorDetail{{
+			Type:      "type.googleapis.com/google.firebase.fcm.v1.FcmError",
+			ErrorCode: errorCode,
+		}}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": v1Err})
+}
+
+// v1Equivalent maps the legacy API error code to HTTP status, status and error code of HTTP v1 API.
+func v1Equivalent(code string) (int, string, string) {
+	switch code {
+	case fcm.ErrorNotRegistered:
+		return http.StatusNotFound, "NOT_FOUND", fcm.V1ErrorUnregistered
+	case fcm.ErrorMismatchSenderId:
+		return http.StatusForbidden, "PERMISSION_DENIED", fcm.V1ErrorSenderIdMismatch
+	case fcm.ErrorUnavailable:
+		return http.StatusServiceUnavailable, "UNAVAILABLE", fcm.V1ErrorUnavailable
+	case fcm.ErrorInternalServerError:
+		return http.StatusInternalServerError, "INTERNAL", fcm.V1ErrorInternal
+	case fcm.ErrorDeviceMessageRateExceeded, fcm.ErrorTopicsMessageRateExceeded:
+		return http.StatusTooManyRequests, "RESOURCE_EXHAUSTED", fcm.V1ErrorQuotaExceeded
+	}
+	return http.StatusBadRequest, "INVALID_ARGUMENT", fcm.V1ErrorInvalidArgument
+}
+
+// staticToken is a TokenSource which always returns the same token.
+type staticToken string
+
+func (t staticToken) Token(ctx context.Context) (string, error) {
+	return string(t), nil
+}
@@ -0,0 +1,3 @@
+module github.com/tinode/fcm
+
+go 1.20
@@ -0,0 +1,174 @@
+package fcm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+const (
+	// Device group management endpoint
+	deviceGroupPath = "/fcm/notification"
+
+	// Device group operations
+	groupOperationCreate = "create"
+	groupOperationAdd    = "add"
+	groupOperationRemove = "remove"
+)
+
+// deviceGroupRequest is the body of a device group management request.
+type deviceGroupRequest struct {
+	Operation       string   `json:"operation"`
+	NotificationKey string   `json:"notification_key,omitempty"`
+	KeyName         string   `json:"notification_key_name"`
+	RegistrationIds []string `json:"registration_ids"`
+}
+
+// deviceGroupResponse is the response to a device group management request.
+type deviceGroupResponse struct {
+	NotificationKey string `json:"notification_key"`
+	Error           string `json:"error"`
+}
+
+// CreateDeviceGroup creates a device group with the given name and registration tokens and returns
+// the notification key of the group. The key can be used as HttpMessage.To to send one message
+// to all devices in the group. The senderID is the sender ID (project number) of the app.
+func (c *Client) CreateDeviceGroup(senderID, name string, tokens []string) (string, error) {
+	return c.CreateDeviceGroupContext(context.Background(), senderID, name, tokens)
+}
+
+// CreateDeviceGroupContext is the same as CreateDeviceGroup but the request is bound to the given context.
+func (c *Client) CreateDeviceGroupContext(ctx context.Context, senderID, name string, tokens []string) (string, error) {
+	return c.manageDeviceGroup(ctx, "fcm.CreateDeviceGroup", senderID, &deviceGroupRequest{
+		Operation:       groupOperationCreate,
+		KeyName:         name,
+		RegistrationIds: tokens,
+	})
+}
+
+// AddToDeviceGroup adds registration tokens to an existing device group.
+func (c *Client) AddToDeviceGroup(senderID, name, key string, tokens []string) (string, error) {
+	return c.AddToDeviceGroupContext(context.Background(), senderID, name, key, tokens)
+}
+
+// AddToDeviceGroupContext is the same as AddToDeviceGroup but the request is bound to the given context.
+func (c *Client) AddToDeviceGroupContext(ctx context.Context, senderID, name, key string, tokens []string) (string, error) {
+	return c.manageDeviceGroup(ctx, "fcm.AddToDeviceGroup", senderID, &deviceGroupRequest{
+		Operation:       groupOperationAdd,
+		NotificationKey: key,
+		KeyName:         name,
+		RegistrationIds: tokens,
+	})
+}
+
+// RemoveFromDeviceGroup removes registration tokens from a device group. The group is deleted
+// when all tokens are removed.
+func (c *Client) RemoveFromDeviceGroup(senderID, name, key string, tokens []string) (string, error) {
+	return c.RemoveFromDeviceGroupContext(context.Background(), senderID, name, key, tokens)
+}
+
+// RemoveFromDeviceGroupContext is the same as RemoveFromDeviceGroup but the request is bound to the given context.
+func (c *Client) RemoveFromDeviceGroupContext(ctx context.Context, senderID, name, key string, tokens []string) (string, error) {
+	return c.manageDeviceGroup(ctx, "fcm.RemoveFromDeviceGroup", senderID, &deviceGroupRequest{
+		Operation:       groupOperationRemove,
+		NotificationKey: key,
+		KeyName:         name,
+		RegistrationIds: tokens,
+	})
+}
+
+// GetDeviceGroupKey returns the notification key of the device group with the given name.
+func (c *Client) GetDeviceGroupKey(senderID, name string) (string, error) {
+	return c.GetDeviceGroupKeyContext(context.Background(), senderID, name)
+}
+
+// GetDeviceGroupKeyContext is the same as GetDeviceGroupKey but the request is bound to the given context.
+func (c *Client) GetDeviceGroupKeyContext(ctx context.Context, senderID, name string) (string, error) {
+	if name == "" {
+		return "", errors.New("fcm: device group name is empty")
+	}
+	return c.deviceGroupRequest(ctx, "fcm.GetDeviceGroupKey", http.MethodGet,
+		deviceGroupPath+"?notification_key_name="+url.QueryEscape(name), senderID, nil)
+}
+
+func (c *Client) manageDeviceGroup(ctx context.Context, operation, senderID string, op *deviceGroupRequest) (string, error) {
+	if op.KeyName == "" {
+		return "", errors.New("fcm: device group name is empty")
+	}
+	if len(op.RegistrationIds) == 0 {
+		return "", errors.New("fcm: no registration tokens")
+	}
+	if op.Operation != groupOperationCreate && op.NotificationKey == "" {
+		return "", errors.New("fcm: notification key is empty")
+	}
+
+	payload, err := json.Marshal(op)
+	if err != nil {
+		return "", err
+	}
+	return c.deviceGroupRequest(ctx, operation, http.MethodPost, deviceGroupPath, senderID, bytes.NewReader(payload))
+}
+
+// deviceGroupRequest issues a device group management request and returns the notification key.
+func (c *Client) deviceGroupRequest(ctx context.Context, operation, method, path, senderID string,
+	payload io.Reader) (key string, err error) {
+
+	if senderID == "" {
+		return "", errors.New("fcm: sender ID is empty")
+	}
+	if err := c.startSend(); err != nil {
+		return "", err
+	}
+	defer c.endSend()
+
+	var statusCode int
+	ctx, end := c.startSpan(ctx, operation)
+	defer func() { end(statusCode, err) }()
+
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	auth, err := c.authorization(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(method, c.fcmURL+path, payload)
+	if err != nil {
+		return "", err
+	}
+	req = req.WithContext(c.withClientTrace(ctx))
+	req.Header.Add(http.CanonicalHeaderKey("Content-Type"), "application/json")
+	req.Header.Add(http.CanonicalHeaderKey("Authorization"), auth)
+	req.Header.Add(http.CanonicalHeaderKey("project_id"), senderID)
+	if c.tokens != nil {
+		// Required to accept OAuth2 access tokens.
+		req.Header.Add(http.CanonicalHeaderKey("access_token_auth"), "true")
+	}
+
+	c.addHeaders(req)
+	httpResp, body, err := roundTrip(c.connection, req)
+	if err != nil {
+		return "", err
+	}
+	statusCode = httpResp.StatusCode
+
+	if httpResp.StatusCode != http.StatusOK {
+		// The body is usually {"error":"description"}
+		return "", newHttpError(httpResp, body)
+	}
+
+	var response deviceGroupResponse
+	if err = json.Unmarshal(body, &response); err != nil {
+		return "", err
+	}
+	if response.Error != "" {
+		return "", errors.New("fcm: " + response.Error)
+	}
+
+	return response.NotificationKey, nil
+}
@@ -0,0 +1,59 @@
+package fcm
+
+import (
+	"context"
+	"net/http"
+)
+
+// Version is the version of the package reported in the default User-Agent.
+const Version = "1.0.0"
+
+// Default value of the User-Agent header.
+const defaultUserAgent = "tinode-fcm/" + Version + " (+https://github.com/tinode/fcm)"
+
+// WithUserAgent sets the User-Agent header of requests. Default is "tinode-fcm/" followed by
+// Version and the project URL.
+func WithUserAgent(userAgent string) Option {
+	return func(o *clientOptions) {
+		o.userAgent = userAgent
+	}
+}
+
+// WithHeader adds the header to every request of the client, e.g. for authentication with
+// an egress gateway. It may be used more than once, also with the same name. Headers set
+// by the client itself, such as Authorization or Content-Type, should not be used.
+func WithHeader(name, value string) Option {
+	return func(o *clientOptions) {
+		if o.headers == nil {
+			o.headers = make(http.Header)
+		}
+		o.headers.Add(name, value)
+	}
+}
+
+type headersKey struct{}
+
+// ContextWithHeaders returns the context which makes the requests of a single send carry the
+// headers, such as a tracing ID:
+//
+//	ctx = fcm.ContextWithHeaders(ctx, http.Header{"X-Request-Id": {id}})
+//	resp, err := client.SendHttpContext(ctx, msg)
+//
+// Headers of the context replace the same named headers set with WithHeader and by the client
+// itself, like Authorization.
+func ContextWithHeaders(ctx context.Context, header http.Header) context.Context {
+	return context.WithValue(ctx, headersKey{}, header)
+}
+
+// addHeaders adds User-Agent and custom headers of the client and the request context to the request.
+func (c *Client) addHeaders(req *http.Request) {
+	req.Header.Set(http.CanonicalHeaderKey("User-Agent"), c.userAgent)
+	for name, values := range c.headers {
+		req.Header[name] = append(req.Header[name], values...)
+	}
+	if header, ok := req.Context().Value(headersKey{}).(http.Header); ok {
+		for name, values := range header {
+			req.Header[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package fcm
+
+import (
+	"context"
+	"net/http/httptrace"
+)
+
+// WithClientTrace attaches the trace hooks, such as DNSStart, ConnectDone, TLSHandshakeDone or
+// GotFirstResponseByte, to every request of the client. The hooks are called concurrently
+// for concurrent sends. To trace a single send, attach the hooks to its context instead:
+//
+//	ctx := httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{...})
+//	resp, err := client.SendHttpContext(ctx, msg)
+//
+// The hooks of the client are called before the hooks of the context.
+func WithClientTrace(trace *httptrace.ClientTrace) Option {
+	return func(o *clientOptions) {
+		o.clientTrace = trace
+	}
+}
+
+// withClientTrace adds the trace hooks of the client to the request context.
+func (c *Client) withClientTrace(ctx context.Context) context.Context {
+	if c.clientTrace == nil {
+		return ctx
+	}
+	return httptrace.WithClientTrace(ctx, c.clientTrace)
+}
@@ -0,0 +1,39 @@
+package fcm
+
+import (
+	"time"
+)
+
+// WithKeepAlive sets the interval of TCP keep-alive probes of connections to the servers,
+// so connections broken by network partitions are detected and dropped from the pool.
+// Default is 15 seconds, negative value disables keep-alive probes.
+func WithKeepAlive(interval time.Duration) Option {
+	return func(o *clientOptions) {
+		o.keepAlive = interval
+	}
+}
+
+// idleCloser is implemented by http.Transport and http.Client.
+type idleCloser interface {
+	CloseIdleConnections()
+}
+
+// CloseIdleConnections closes connections in the pool which are not currently in use,
+// e.g. after a network change, so the next requests establish new connections. Connections
+// in use are not interrupted. It has no effect if the RoundTripper set with WithRoundTripper
+// doesn't implement CloseIdleConnections.
+func (c *Client) CloseIdleConnections() {
+	if ic, ok := c.connection.(idleCloser); ok {
+		ic.CloseIdleConnections()
+	}
+}
+
+func (t *debugTransport) CloseIdleConnections() {
+	if ic, ok := t.next.(idleCloser); ok {
+		ic.CloseIdleConnections()
+	}
+}
+
+func (t httpClientTransport) CloseIdleConnections() {
+	t.client.CloseIdleConnections()
+}
@@ -0,0 +1,75 @@
+package fcm
+
+import (
+	"net"
+)
+
+// IPFamily selects the IP versions used to connect to the servers.
+type IPFamily int
+
+const (
+	// IPFamilyAny uses both IPv4 and IPv6 as the system prefers. This is the default.
+	IPFamilyAny IPFamily = iota
+	// IPFamilyPreferIPv4 tries IPv4 addresses first and then IPv6.
+	IPFamilyPreferIPv4
+	// IPFamilyPreferIPv6 tries IPv6 addresses first and then IPv4.
+	IPFamilyPreferIPv6
+	// IPFamilyIPv4Only connects over IPv4 only.
+	IPFamilyIPv4Only
+	// IPFamilyIPv6Only connects over IPv6 only.
+	IPFamilyIPv6Only
+)
+
+// WithIPFamily sets the IP versions used to connect to the servers, e.g. IPFamilyIPv4Only
+// to work around broken IPv6 routes. The addresses are tried one by one in the preferred order.
+func WithIPFamily(family IPFamily) Option {
+	return func(o *clientOptions) {
+		o.ipFamily = family
+	}
+}
+
+// network returns the network to dial, such as "tcp4".
+func (f IPFamily) network(network string) string {
+	if network != "tcp" {
+		return network
+	}
+	switch f {
+	case IPFamilyIPv4Only:
+		return "tcp4"
+	case IPFamilyIPv6Only:
+		return "tcp6"
+	}
+	return network
+}
+
+// order returns the addresses of the allowed families in the preferred order.
+func (f IPFamily) order(addrs []string) []string {
+	if f == IPFamilyAny {
+		return addrs
+	}
+
+	var v4, v6 []string
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			continue
+		}
+		if ip.To4() != nil {
+			v4 = append(v4, addr)
+		} else {
+			v6 = append(v6, addr)
+		}
+	}
+
+	switch f {
+	case IPFamilyPreferIPv4:
+		return append(v4, v6...)
+	case IPFamilyPreferIPv6:
+		return append(v6, v4...)
+	case IPFamilyIPv4Only:
+		return v4
+	case IPFamilyIPv6Only:
+		return v6
+	}
+	return addrs
+}
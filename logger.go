@@ -0,0 +1,29 @@
+package fcm
+
+import (
+	"time"
+)
+
+// Logger receives structured log events. The args are alternating keys and values, such as
+// "status", 200, "latency", time.Duration. It's satisfied by *slog.Logger. A logr.Logger can
+// be used with a small adapter.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// logRequest logs a single HTTP request to FCM.
+func (c *Client) logRequest(api string, size, statusCode int, latency time.Duration, err error) {
+	if c.logger == nil {
+		return
+	}
+	if err != nil {
+		c.logger.Warn("fcm: request failed", "api", api, "size", size, "status", statusCode,
+			"latency", latency, "error", err)
+		return
+	}
+	c.logger.Debug("fcm: request completed", "api", api, "size", size, "status", statusCode,
+		"latency", latency)
+}
@@ -0,0 +1,144 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+)
+
+// MaxRegistrationIds is the maximum number of registration IDs FCM accepts in one request.
+const MaxRegistrationIds = 1000
+
+// SendMulticast sends the message to an arbitrary number of registration IDs. If msg.RegistrationIds
+// has more than MaxRegistrationIds entries, the list is split into chunks which are sent concurrently
+// (see WithMulticastConcurrency).
+// The responses are merged into one: counters are summed, Results are in the order of
+// msg.RegistrationIds, MulticastId is the ID of the first successfully sent chunk,
+// RetryAfter is the longest of all chunks.
+// If a chunk fails, its results carry Unavailable or InternalServerError and are counted as
+// failures, the error of the chunk is reported by *MulticastError. If all chunks
+// have failed, only the error is returned. If some tokens have failed, the response is
+// returned together with *MulticastError describing the failures.
+func (c *Client) SendMulticast(msg *HttpMessage) (*HttpResponse, error) {
+	return c.SendMulticastContext(context.Background(), msg)
+}
+
+// SendMulticastContext is the same as SendMulticast but the requests are bound to the given context.
+func (c *Client) SendMulticastContext(ctx context.Context, msg *HttpMessage) (*HttpResponse, error) {
+	resp, chunkErrs, err := c.sendMulticast(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+	if mErr := newMulticastError(resp, chunkErrs); mErr != nil {
+		return resp, mErr
+	}
+	return resp, nil
+}
+
+// sendMulticast sends the message in chunks and merges the responses. It also returns the
+// errors of the failed chunks, nil for the successful ones.
+func (c *Client) sendMulticast(ctx context.Context, msg *HttpMessage) (resp *HttpResponse,
+	chunkErrs []error, err error) {
+
+	if len(msg.RegistrationIds) <= MaxRegistrationIds {
+		resp, err = c.SendHttpContext(ctx, msg)
+		return resp, nil, err
+	}
+
+	// The chunks are deduplicated as a whole.
+	if !msg.DryRun {
+		sent, claimErr := c.claimKey(msg.IdempotencyKey)
+		if claimErr != nil {
+			return nil, nil, claimErr
+		}
+		defer func() { sent(err) }()
+	}
+
+	type chunkResult struct {
+		resp *HttpResponse
+		err  error
+	}
+
+	tokens := msg.RegistrationIds
+	count := (len(tokens) + MaxRegistrationIds - 1) / MaxRegistrationIds
+	results := make([]chunkResult, count)
+
+	// Limit the number of chunks sent at the same time.
+	concurrency := c.multicastConcurrency
+	if concurrency <= 0 || concurrency > count {
+		concurrency = count
+	}
+	sem := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for i := 0; i < count; i++ {
+		end := (i + 1) * MaxRegistrationIds
+		if end > len(tokens) {
+			end = len(tokens)
+		}
+		chunk := *msg
+		chunk.RegistrationIds = tokens[i*MaxRegistrationIds : end]
+		chunk.IdempotencyKey = ""
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, chunk *HttpMessage) {
+			defer wg.Done()
+			resp, err := c.SendHttpContext(ctx, chunk)
+			results[i] = chunkResult{resp: resp, err: err}
+			<-sem
+		}(i, &chunk)
+	}
+	wg.Wait()
+
+	merged := &HttpResponse{Results: make([]Result, 0, len(tokens)), tokens: tokens}
+	var errs []error
+	chunkErrs = make([]error, count)
+	for i, r := range results {
+		size := MaxRegistrationIds
+		if i == count-1 {
+			size = len(tokens) - i*MaxRegistrationIds
+		}
+
+		if r.err != nil {
+			errs = append(errs, r.err)
+			chunkErrs[i] = r.err
+			merged.Fail += size
+			code := chunkErrorCode(r.err)
+			for j := 0; j < size; j++ {
+				merged.Results = append(merged.Results, Result{Error: code})
+			}
+			continue
+		}
+
+		if merged.MulticastId == 0 {
+			merged.MulticastId = r.resp.MulticastId
+		}
+		merged.Success += r.resp.Success
+		merged.Fail += r.resp.Fail
+		merged.CanonicalIds += r.resp.CanonicalIds
+		if r.resp.RetryAfter > merged.RetryAfter {
+			merged.RetryAfter = r.resp.RetryAfter
+		}
+		merged.Results = append(merged.Results, r.resp.Results...)
+	}
+
+	if len(errs) == count {
+		return nil, nil, errors.Join(errs...)
+	}
+
+	return merged, chunkErrs, nil
+}
+
+// chunkErrorCode returns the result error code reported for the tokens of the chunk which
+// failed as a whole: InternalServerError if the server failed with 5xx other than 503,
+// Unavailable otherwise. The error itself is returned with the chunk errors.
+func chunkErrorCode(err error) string {
+	var httpErr *HttpError
+	if errors.As(err, &httpErr) && httpErr.StatusCode >= http.StatusInternalServerError &&
+		httpErr.StatusCode != http.StatusServiceUnavailable {
+		return ErrorInternalServerError
+	}
+	return ErrorUnavailable
+}
@@ -0,0 +1,23 @@
+package fcm
+
+import (
+	"time"
+)
+
+// Observer is notified about completed sends, e.g. to collect metrics.
+type Observer interface {
+	// OnSend is called after each send completes, successfully or not. If retrying is enabled,
+	// it is called for each attempt. The duration is the time spent sending the request and
+	// reading the response. The statusCode is the HTTP status of the response or zero if
+	// no response was received, e.g. in case of a network error. The resp may be nil if err
+	// is not nil.
+	// OnSend is called synchronously on the sending go routine without holding any locks.
+	// It may be called concurrently from multiple go routines.
+	OnSend(duration time.Duration, statusCode int, resp *HttpResponse, err error)
+}
+
+// RetryObserver is an optional interface of the Observer notified before each retry.
+type RetryObserver interface {
+	// OnRetry is called before the given attempt, counting from 2, is made after the delay.
+	OnRetry(attempt int, delay time.Duration)
+}
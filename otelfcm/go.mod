@@ -0,0 +1,14 @@
+module github.com/tinode/fcm/otelfcm
+
+go 1.25.0
+
+require (
+	github.com/tinode/fcm v0.0.0
+	go.opentelemetry.io/otel v1.46.0
+	go.opentelemetry.io/otel/trace v1.46.0
+)
+
+require github.com/cespare/xxhash/v2 v2.3.0 // indirect
+
+// The package is developed together with the core in the same repository.
+replace github.com/tinode/fcm => ../
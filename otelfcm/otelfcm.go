@@ -0,0 +1,69 @@
+// Package otelfcm traces calls of the FCM client with OpenTelemetry.
+//
+//	client := fcm.NewClient(apiKey, fcm.WithTracer(otelfcm.NewTracer(otel.GetTracerProvider())))
+//
+// Since the spans are started from the context of the call, they become children of the caller's span.
+// Configure the HTTP transport, e.g. with otelhttp, to propagate the trace to the requests.
+package otelfcm
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tinode/fcm"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name of the instrumentation library.
+const instrumentationName = "github.com/tinode/fcm/otelfcm"
+
+// Tracer is an fcm.Tracer creating OpenTelemetry spans.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+var _ fcm.Tracer = (*Tracer)(nil)
+
+// NewTracer creates a tracer using spans of the given provider.
+func NewTracer(tp trace.TracerProvider) *Tracer {
+	return &Tracer{tracer: tp.Tracer(instrumentationName)}
+}
+
+// Start starts a client span of the operation.
+func (t *Tracer) Start(ctx context.Context, operation string, attrs ...fcm.Attribute) (context.Context, func(int, error)) {
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		kvs = append(kvs, convert(a))
+	}
+
+	ctx, span := t.tracer.Start(ctx, operation, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(kvs...))
+	return ctx, func(statusCode int, err error) {
+		if statusCode != 0 {
+			span.SetAttributes(attribute.Int("http.response.status_code", statusCode))
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// convert converts the attribute to OpenTelemetry key-value.
+func convert(a fcm.Attribute) attribute.KeyValue {
+	switch v := a.Value.(type) {
+	case string:
+		return attribute.String(a.Key, v)
+	case int:
+		return attribute.Int(a.Key, v)
+	case int64:
+		return attribute.Int64(a.Key, v)
+	case bool:
+		return attribute.Bool(a.Key, v)
+	case float64:
+		return attribute.Float64(a.Key, v)
+	}
+	return attribute.String(a.Key, fmt.Sprint(a.Value))
+}
@@ -0,0 +1,200 @@
+package fcm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Outbox persists messages of the send queue so they survive process restarts, see
+// QueueConfig.Outbox. Implementations must be safe for concurrent use.
+type Outbox interface {
+	// Save persists the encoded message under the key.
+	Save(key string, msg []byte) error
+	// Remove deletes the message once it's no longer pending.
+	Remove(key string) error
+	// Pending returns the saved and not yet removed messages ordered by key.
+	Pending() ([]OutboxEntry, error)
+}
+
+// OutboxEntry is a message saved in the Outbox.
+type OutboxEntry struct {
+	Key     string
+	Message []byte
+}
+
+const outboxFileExt = ".json"
+
+// FileOutbox is an Outbox which keeps each message in a separate file in the directory.
+type FileOutbox struct {
+	dir string
+	// Serializes Pending with Save and Remove.
+	mu sync.RWMutex
+}
+
+// NewFileOutbox creates the outbox in the directory. The directory is created if missing.
+func NewFileOutbox(dir string) (*FileOutbox, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileOutbox{dir: dir}, nil
+}
+
+// Save writes the message to a temporary file first and then renames it, so a crash never
+// leaves a partially written message.
+func (o *FileOutbox) Save(key string, msg []byte) error {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	tmp, err := ioutil.TempFile(o.dir, "."+key+"-*")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(msg); err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), o.path(key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Remove deletes the file of the message. Removing a missing message is not an error.
+func (o *FileOutbox) Remove(key string) error {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	if err := os.Remove(o.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Pending reads all messages in the directory.
+func (o *FileOutbox) Pending() ([]OutboxEntry, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	files, err := ioutil.ReadDir(o.dir)
+	if err != nil {
+		return nil, err
+	}
+	var entries []OutboxEntry
+	for _, f := range files {
+		name := f.Name()
+		// Skip temporary files left by interrupted saves.
+		if f.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, outboxFileExt) {
+			continue
+		}
+		msg, err := ioutil.ReadFile(filepath.Join(o.dir, name))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, OutboxEntry{Key: strings.TrimSuffix(name, outboxFileExt), Message: msg})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries, nil
+}
+
+func (o *FileOutbox) path(key string) string {
+	return filepath.Join(o.dir, key+outboxFileExt)
+}
+
+// outboxSeq disambiguates keys generated within the same nanosecond.
+var outboxSeq uint32
+
+// outboxKey returns a new unique key. Keys sort in the order they were generated.
+func outboxKey() string {
+	return fmt.Sprintf("%019d-%010d", time.Now().UnixNano(), atomic.AddUint32(&outboxSeq, 1))
+}
+
+// saveOutbox persists the queued message, it returns the key of the message.
+func (c *Client) saveOutbox(msg *HttpMessage) (string, error) {
+	data, err := json.Marshal(&outboxEnvelope{Message: msg, IdempotencyKey: msg.IdempotencyKey})
+	if err != nil {
+		return "", err
+	}
+	key := outboxKey()
+	if err = c.queueConfig.Outbox.Save(key, data); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// outboxEnvelope is the outbox record of the message, it keeps the fields which are not
+// sent to FCM.
+type outboxEnvelope struct {
+	Message        *HttpMessage `json:"message"`
+	IdempotencyKey string       `json:"idempotency_key,omitempty"`
+}
+
+// removeOutbox deletes the message with the key from the outbox, if any.
+func (c *Client) removeOutbox(key string) {
+	if key == "" {
+		return
+	}
+	if err := c.queueConfig.Outbox.Remove(key); err != nil && c.logger != nil {
+		c.logger.Warn("fcm: outbox remove failed", "key", key, "error", err)
+	}
+}
+
+// loadOutbox reads the messages left in the outbox by the previous process. It must be called
+// before the client is returned to the caller so the messages enqueued by this process are
+// not sent twice.
+func (c *Client) loadOutbox() []*queueItem {
+	entries, err := c.queueConfig.Outbox.Pending()
+	if err != nil {
+		if c.logger != nil {
+			c.logger.Error("fcm: outbox load failed", "error", err)
+		}
+		return nil
+	}
+	var items []*queueItem
+	for _, entry := range entries {
+		var envelope outboxEnvelope
+		err := json.Unmarshal(entry.Message, &envelope)
+		msg := envelope.Message
+		if err == nil && msg == nil {
+			err = errors.New("fcm: message is missing in outbox entry")
+		}
+		if err == nil {
+			msg.IdempotencyKey = envelope.IdempotencyKey
+			err = c.checkMessage(msg)
+		}
+		if err != nil {
+			if c.logger != nil {
+				c.logger.Error("fcm: invalid message in outbox", "key", entry.Key, "error", err)
+			}
+			c.removeOutbox(entry.Key)
+			continue
+		}
+		item := c.newQueueItem(msg)
+		item.key = entry.Key
+		items = append(items, item)
+	}
+	return items
+}
+
+// resendOutbox pushes the messages loaded from the outbox into the send queue.
+func (c *Client) resendOutbox(items []*queueItem) {
+	for _, item := range items {
+		if !c.push(item) {
+			// The client is closed, the rest stays in the outbox.
+			return
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package fcm
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOutboxRecovery(t *testing.T) {
+	dir := t.TempDir()
+	outbox, err := NewFileOutbox(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Messages left by the previous process, along with a torn write and a corrupt entry.
+	for i, to := range []string{"a", "b"} {
+		data, err := json.Marshal(&outboxEnvelope{Message: &HttpMessage{To: to}, IdempotencyKey: "k" + to})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := outbox.Save(outboxKey(), data); err != nil {
+			t.Fatalf("save %d: %v", i, err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, ".torn-1"), []byte(`{"mess`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := outbox.Save(outboxKey(), []byte(`{"message":null}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := newGateServer(t)
+	srv.open()
+	results := newQueueResults()
+	c := NewClient("key", WithBaseURL(srv.URL), WithQueue(QueueConfig{Outbox: outbox, OnResult: results.onResult}))
+	received := srv.waitReceived(t, 2)
+	if err := c.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(received) != 2 || received[0].To != "a" || received[1].To != "b" {
+		t.Errorf("received %+v, want a and b in order", received)
+	}
+	for _, to := range []string{"a", "b"} {
+		if err, ok := results.get(to); !ok || err != nil {
+			t.Errorf("result of %s = %v, %v, want sent", to, err, ok)
+		}
+	}
+	pending, err := outbox.Pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("%d messages left in the outbox, want none", len(pending))
+	}
+	if _, err := os.Stat(filepath.Join(dir, ".torn-1")); err != nil {
+		t.Errorf("temporary file: %v, want it left alone", err)
+	}
+}
+
+func TestOutboxKeepsUnsent(t *testing.T) {
+	outbox, err := NewFileOutbox(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newGateServer(t)
+	c := NewClient("key", WithBaseURL(srv.URL), WithQueue(QueueConfig{Workers: 1, Outbox: outbox}))
+	for _, to := range []string{"a", "b"} {
+		if err := c.Enqueue(context.Background(), &HttpMessage{To: to}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if pending, err := outbox.Pending(); err != nil || len(pending) != 2 {
+		t.Fatalf("outbox holds %d messages, %v, want 2", len(pending), err)
+	}
+
+	// The process dies before anything is sent: the next client sends the messages.
+	srv2 := newGateServer(t)
+	srv2.open()
+	c2 := NewClient("key", WithBaseURL(srv2.URL), WithQueue(QueueConfig{Workers: 1, Outbox: outbox}))
+	received := srv2.waitReceived(t, 2)
+	if err := c2.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if received[0].To != "a" || received[1].To != "b" {
+		t.Errorf("resent %s and %s, want a and b", received[0].To, received[1].To)
+	}
+	srv.open()
+	c.Close(context.Background())
+}
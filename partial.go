@@ -0,0 +1,91 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+)
+
+// transientResults returns the indexes of the results which failed with a transient error.
+func transientResults(resp *HttpResponse) []int {
+	var failed []int
+	for i, r := range resp.Results {
+		if r.Error == ErrorUnavailable || r.Error == ErrorInternalServerError {
+			failed = append(failed, i)
+		}
+	}
+	return failed
+}
+
+// retryFailedTokens re-sends the message to the tokens which failed with Unavailable or
+// InternalServerError while the other tokens have succeeded or failed permanently. The new
+// results are merged into the response. Requests which failed for all tokens are retried by
+// sendPayload. The retries continue counting the attempts and the elapsed time in the state.
+func (c *Client) retryFailedTokens(ctx context.Context, msg *HttpMessage, resp *HttpResponse,
+	result *SendResult, state *retryState) {
+
+	tokens := msg.RegistrationIds
+	if c.retry == nil || len(tokens) < 2 || len(resp.Results) != len(tokens) {
+		return
+	}
+	failed := transientResults(resp)
+	if len(failed) == 0 || len(failed) == len(tokens) {
+		return
+	}
+
+	retryAfter := resp.RetryAfter
+	var err error = ResultError{Code: resp.Results[failed[0]].Error}
+	for c.retryWait(ctx, state, retryAfter, err) {
+		state.attempts++
+		if result != nil {
+			result.Attempts = state.attempts
+		}
+		a := c.resendTokens(ctx, msg, failed)
+		retryAfter = parseRetryAfter(a.retryAfter)
+		if a.err != nil {
+			if !c.retryableError(ctx, a.statusCode, a.err) {
+				return
+			}
+			err = a.err
+			continue
+		}
+		for j, i := range failed {
+			r := a.resp.Results[j]
+			resp.Results[i] = r
+			if r.Error == "" {
+				resp.Success++
+				resp.Fail--
+			}
+			if r.RegistrationId != "" {
+				resp.CanonicalIds++
+			}
+		}
+		if failed = transientResults(resp); len(failed) == 0 {
+			return
+		}
+		err = ResultError{Code: resp.Results[failed[0]].Error}
+	}
+}
+
+// resendTokens sends a copy of the message to the tokens with the given indexes.
+func (c *Client) resendTokens(ctx context.Context, msg *HttpMessage, indexes []int) attempt {
+	partial := *msg
+	partial.RegistrationIds = make([]string, len(indexes))
+	for j, i := range indexes {
+		partial.RegistrationIds[j] = msg.RegistrationIds[i]
+	}
+
+	payload, err := c.encodeBody(&partial)
+	if err != nil {
+		return attempt{err: err}
+	}
+	defer payload.release()
+
+	if c.gzip {
+		payload = &gzipBody{payload: payload}
+	}
+	a := c.post(ctx, payload)
+	if a.err == nil && (a.resp == nil || len(a.resp.Results) != len(indexes)) {
+		a.err = errors.New("fcm: number of results does not match the number of tokens")
+	}
+	return a
+}
@@ -0,0 +1,65 @@
+package fcm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSendHttpRetriesFailedTokens(t *testing.T) {
+	// Token "b" is unavailable on the first attempt, "c" is not registered.
+	var mu sync.Mutex
+	var requests [][]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg HttpMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		first := len(requests) == 0
+		requests = append(requests, msg.RegistrationIds)
+		mu.Unlock()
+
+		resp := HttpResponse{MulticastId: 1}
+		for _, token := range msg.RegistrationIds {
+			switch {
+			case token == "c":
+				resp.Fail++
+				resp.Results = append(resp.Results, Result{Error: ErrorNotRegistered})
+			case token == "b" && first:
+				resp.Fail++
+				resp.Results = append(resp.Results, Result{Error: ErrorUnavailable})
+			default:
+				resp.Success++
+				resp.Results = append(resp.Results, Result{MessageId: "0:" + token})
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(&resp)
+	}))
+	defer srv.Close()
+
+	c := NewClient("key", WithBaseURL(srv.URL), WithRetry(RetryConfig{InitialInterval: time.Millisecond}))
+	defer c.Close(context.Background())
+	resp, err := c.SendHttp(&HttpMessage{RegistrationIds: []string{"a", "b", "c"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(requests) != 2 || len(requests[1]) != 1 || requests[1][0] != "b" {
+		t.Fatalf("requests = %v, want the retry to b alone", requests)
+	}
+	if resp.Success != 2 || resp.Fail != 1 {
+		t.Errorf("success %d, fail %d, want 2 and 1", resp.Success, resp.Fail)
+	}
+	if resp.Results[1].MessageId != "0:b" || resp.Results[2].Error != ErrorNotRegistered {
+		t.Errorf("results = %+v, want b sent and c not registered", resp.Results)
+	}
+}
@@ -0,0 +1,54 @@
+package fcm
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// Prefix of the public key pins.
+const pinPrefix = "sha256/"
+
+// WithPinnedKeys makes the client accept server certificates only if the verified chain
+// contains a certificate with one of the public keys. A pin is the base64-encoded SHA-256
+// hash of the DER-encoded SubjectPublicKeyInfo, optionally prefixed with "sha256/", see
+// PublicKeyPin. To allow key rotation, pin the keys of the intermediate or root CAs and
+// include backup keys. The pins apply to all servers the client connects to.
+func WithPinnedKeys(pins ...string) Option {
+	return func(o *clientOptions) {
+		for _, pin := range pins {
+			o.pinnedKeys = append(o.pinnedKeys, strings.TrimPrefix(pin, pinPrefix))
+		}
+	}
+}
+
+// PublicKeyPin returns the pin of the public key of the certificate for WithPinnedKeys.
+func PublicKeyPin(cert *x509.Certificate) string {
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return pinPrefix + base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// verifyPins returns the function checking the verified chains of the connection against the pins.
+// The next function, if any, is called after the successful check.
+func verifyPins(pins []string, next func(tls.ConnectionState) error) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		for _, chain := range cs.VerifiedChains {
+			for _, cert := range chain {
+				pin := strings.TrimPrefix(PublicKeyPin(cert), pinPrefix)
+				for _, p := range pins {
+					if p != pin {
+						continue
+					}
+					if next != nil {
+						return next(cs)
+					}
+					return nil
+				}
+			}
+		}
+		return errors.New("fcm: server certificate does not match pinned keys")
+	}
+}
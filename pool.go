@@ -0,0 +1,173 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrPoolClosed is returned by Pool.Submit after the pool has been closed.
+var ErrPoolClosed = errors.New("fcm: pool is closed")
+
+// Pool sends messages through the client on a fixed number of worker go routines.
+// The number of workers can be changed at runtime with Resize. Pool must be created
+// with NewPool.
+type Pool struct {
+	client *Client
+	jobs   chan poolJob
+
+	// Guards closing of jobs.
+	closeLock sync.RWMutex
+	closed    bool
+
+	// Guards workers.
+	mu sync.Mutex
+	// Quit channels of the running workers.
+	workers []chan struct{}
+	wg      sync.WaitGroup
+
+	inflight int32
+}
+
+// poolJob is a message waiting for a pool worker.
+type poolJob struct {
+	ctx    context.Context
+	msg    *HttpMessage
+	result chan PostResult
+}
+
+// NewPool starts the pool of workers sending messages through the client. At most queueSize
+// messages wait for a free worker, Submit blocks when the queue is full.
+func NewPool(client *Client, workers, queueSize int) *Pool {
+	if queueSize < 0 {
+		queueSize = 0
+	}
+	p := &Pool{client: client, jobs: make(chan poolJob, queueSize)}
+	p.Resize(workers)
+	return p
+}
+
+// Submit queues the message for sending. The returned channel has capacity 1, it receives
+// exactly one PostResult once the send completes and then it's closed. The send is bound
+// to the context. Submit waits for room in the queue until the context is done.
+func (p *Pool) Submit(ctx context.Context, msg *HttpMessage) (<-chan PostResult, error) {
+	job := poolJob{ctx: ctx, msg: msg, result: make(chan PostResult, 1)}
+
+	// The queue is closed by Close while holding the lock.
+	p.closeLock.RLock()
+	defer p.closeLock.RUnlock()
+	if p.closed {
+		return nil, ErrPoolClosed
+	}
+
+	select {
+	case p.jobs <- job:
+		return job.result, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Send is a blocking version of Submit.
+func (p *Pool) Send(ctx context.Context, msg *HttpMessage) (*HttpResponse, error) {
+	result, err := p.Submit(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+	r := <-result
+	return r.Response, r.Err
+}
+
+// Resize changes the number of workers, at least one worker is kept. Removed workers exit
+// after completing their current send. Resize does nothing after Close.
+func (p *Pool) Resize(workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	// Close waits for the workers, none may be added once it's called.
+	p.closeLock.RLock()
+	defer p.closeLock.RUnlock()
+	if p.closed {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.workers) < workers {
+		quit := make(chan struct{})
+		p.workers = append(p.workers, quit)
+		p.wg.Add(1)
+		go p.work(quit)
+	}
+	for len(p.workers) > workers {
+		last := len(p.workers) - 1
+		close(p.workers[last])
+		p.workers = p.workers[:last]
+	}
+}
+
+// Size returns the number of workers.
+func (p *Pool) Size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.workers)
+}
+
+// InFlight returns the number of messages being sent.
+func (p *Pool) InFlight() int {
+	return int(atomic.LoadInt32(&p.inflight))
+}
+
+// Queued returns the number of messages waiting for a free worker.
+func (p *Pool) Queued() int {
+	return len(p.jobs)
+}
+
+// Close stops accepting messages and waits until the queued messages are sent or the
+// context is done. It does not close the client. Calling Close more than once returns
+// ErrPoolClosed.
+func (p *Pool) Close(ctx context.Context) error {
+	p.closeLock.Lock()
+	if p.closed {
+		p.closeLock.Unlock()
+		return ErrPoolClosed
+	}
+	p.closed = true
+	// Workers exit after sending the queued messages.
+	close(p.jobs)
+	p.closeLock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Pool) work(quit chan struct{}) {
+	defer p.wg.Done()
+	for {
+		select {
+		case <-quit:
+			return
+		case job, ok := <-p.jobs:
+			if !ok {
+				return
+			}
+			atomic.AddInt32(&p.inflight, 1)
+			resp, err := p.client.SendHttpContext(job.ctx, job.msg)
+			atomic.AddInt32(&p.inflight, -1)
+			job.result <- PostResult{Response: resp, Err: err}
+			close(job.result)
+		}
+	}
+}
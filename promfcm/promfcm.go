@@ -0,0 +1,126 @@
+// Package promfcm exports metrics of the FCM client to Prometheus.
+//
+//	collector := promfcm.NewCollector("myapp")
+//	prometheus.MustRegister(collector)
+//	client := fcm.NewClient(apiKey, fcm.WithObserver(collector))
+package promfcm
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tinode/fcm"
+)
+
+// Collector is an fcm.Observer which maintains Prometheus metrics of the client.
+type Collector struct {
+	sends       prometheus.Counter
+	failures    *prometheus.CounterVec
+	latency     prometheus.Histogram
+	retries     prometheus.Counter
+	invalidated prometheus.Counter
+}
+
+var (
+	_ fcm.Observer         = (*Collector)(nil)
+	_ fcm.RetryObserver    = (*Collector)(nil)
+	_ prometheus.Collector = (*Collector)(nil)
+)
+
+// NewCollector creates metrics with the given namespace, e.g. the name of the application.
+// The collector must be registered with a prometheus.Registerer to be exported.
+func NewCollector(namespace string) *Collector {
+	return &Collector{
+		sends: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "fcm",
+			Name:      "requests_total",
+			Help:      "Number of requests sent to FCM, including retries.",
+		}),
+		failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "fcm",
+			Name:      "failures_total",
+			Help:      "Number of failed requests and messages by error code.",
+		}, []string{"code"}),
+		latency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "fcm",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of requests to FCM.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+		retries: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "fcm",
+			Name:      "retries_total",
+			Help:      "Number of retried requests.",
+		}),
+		invalidated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "fcm",
+			Name:      "tokens_invalidated_total",
+			Help:      "Number of registration tokens reported as not registered or invalid.",
+		}),
+	}
+}
+
+// OnSend implements fcm.Observer.
+func (c *Collector) OnSend(duration time.Duration, statusCode int, resp *fcm.HttpResponse, err error) {
+	c.sends.Inc()
+	c.latency.Observe(duration.Seconds())
+
+	if err != nil {
+		c.failures.WithLabelValues(errorCode(statusCode, err)).Inc()
+		return
+	}
+	if resp == nil {
+		return
+	}
+	for _, result := range resp.Results {
+		if result.Error == "" {
+			continue
+		}
+		c.failures.WithLabelValues(result.Error).Inc()
+		if result.Error == fcm.ErrorNotRegistered || result.Error == fcm.ErrorInvalidRegistration {
+			c.invalidated.Inc()
+		}
+	}
+}
+
+// OnRetry implements fcm.RetryObserver.
+func (c *Collector) OnRetry(attempt int, delay time.Duration) {
+	c.retries.Inc()
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.sends.Describe(ch)
+	c.failures.Describe(ch)
+	c.latency.Describe(ch)
+	c.retries.Describe(ch)
+	c.invalidated.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.sends.Collect(ch)
+	c.failures.Collect(ch)
+	c.latency.Collect(ch)
+	c.retries.Collect(ch)
+	c.invalidated.Collect(ch)
+}
+
+// errorCode returns the label of a failed request: the HTTP status code or "network".
+func errorCode(statusCode int, err error) string {
+	var httpErr *fcm.HttpError
+	if errors.As(err, &httpErr) {
+		return strconv.Itoa(httpErr.StatusCode)
+	}
+	if statusCode != 0 {
+		return strconv.Itoa(statusCode)
+	}
+	return "network"
+}
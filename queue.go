@@ -0,0 +1,323 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrQueueDropped is reported to QueueConfig.OnResult for messages dropped from the full queue
+// by the QueueDropOldest policy.
+var ErrQueueDropped = errors.New("fcm: message dropped from the full queue")
+
+// ErrQueueCoalesced is reported to QueueConfig.OnResult for queued messages replaced by a newer
+// message with the same target and collapse key, see QueueConfig.Coalesce.
+var ErrQueueCoalesced = errors.New("fcm: message replaced by a newer one with the same collapse key")
+
+// QueuePolicy is what Enqueue does when the queue is full.
+type QueuePolicy int
+
+const (
+	// QueueBlock waits until there is room in the queue or the context is done.
+	QueueBlock QueuePolicy = iota
+	// QueueDropOldest drops the oldest message in the queue to make room for the new one.
+	QueueDropOldest
+	// QueueError fails with ErrQueueFull.
+	QueueError
+)
+
+const (
+	defaultQueueWorkers  = 1
+	defaultQueueCapacity = 1000
+)
+
+// QueueConfig configures the send queue, see WithQueue.
+type QueueConfig struct {
+	// Workers is the number of go routines sending messages from the queue. Default 1.
+	Workers int
+	// Capacity is the maximum number of messages waiting in the queue. Messages with
+	// PriorityHigh are queued separately, with the same capacity, and are sent before
+	// the messages with normal priority. Default 1000.
+	Capacity int
+	// Policy is applied when the queue is full. Default QueueBlock.
+	Policy QueuePolicy
+	// OnResult is called with the outcome of each queued message, optional. It's called
+	// on the worker go routines, concurrently if there are multiple workers.
+	OnResult func(msg *HttpMessage, resp *HttpResponse, err error)
+	// Outbox persists queued messages until they are sent, optional. Messages left in the
+	// outbox by the previous process are queued again when the client is created. Messages
+	// which failed to send because the client was closing stay in the outbox.
+	Outbox Outbox
+	// Coalesce makes a message replace the queued message with the same collapse key sent to
+	// the same device or topic, like FCM collapses such messages itself. The replaced
+	// message is reported with ErrQueueCoalesced.
+	Coalesce bool
+}
+
+// queueItem is a message in the send queue.
+type queueItem struct {
+	msg *HttpMessage
+	// Key of the message in the outbox, empty if the outbox is not configured.
+	key string
+	// Key of the messages which replace each other, empty if the message is not coalesced.
+	coalesce string
+	// Set when a worker takes the item, guarded by Client.coalesceLock.
+	taken bool
+}
+
+// WithQueue enables Enqueue: messages are pushed into a bounded in-memory queue and sent by
+// a pool of workers.
+func WithQueue(cfg QueueConfig) Option {
+	return func(o *clientOptions) {
+		if cfg.Workers <= 0 {
+			cfg.Workers = defaultQueueWorkers
+		}
+		if cfg.Capacity <= 0 {
+			cfg.Capacity = defaultQueueCapacity
+		}
+		o.queue = &cfg
+	}
+}
+
+// Enqueue validates the message and pushes it into the send queue of the client configured
+// with WithQueue. The message must not be modified afterwards. The outcome of the send is
+// reported to QueueConfig.OnResult. After Close, Enqueue fails with ErrClientClosed, messages
+// already in the queue are still sent.
+func (c *Client) Enqueue(ctx context.Context, msg *HttpMessage) (err error) {
+	if c.queue == nil {
+		return errors.New("fcm: send queue is not configured")
+	}
+	if err := c.checkMessage(msg); err != nil {
+		return err
+	}
+
+	item := c.newQueueItem(msg)
+	if c.queueConfig.Outbox != nil {
+		if item.key, err = c.saveOutbox(msg); err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				c.removeOutbox(item.key)
+			}
+		}()
+	}
+
+	// The queue is closed by Close while holding the lock.
+	c.closeLock.RLock()
+	defer c.closeLock.RUnlock()
+	if c.closed {
+		return ErrClientClosed
+	}
+	if c.replaceQueued(item) {
+		return nil
+	}
+	c.inflight.Add(1)
+
+	queue := c.queueFor(msg)
+	switch c.queueConfig.Policy {
+	case QueueError:
+		select {
+		case queue <- item:
+			c.registerQueued(item)
+			return nil
+		default:
+			c.inflight.Done()
+			return ErrQueueFull
+		}
+	case QueueDropOldest:
+		for {
+			select {
+			case queue <- item:
+				c.registerQueued(item)
+				return nil
+			default:
+			}
+			// Make room and try again: a worker may have taken the oldest message meanwhile.
+			select {
+			case old := <-queue:
+				msg, key := c.takeQueued(old)
+				c.removeOutbox(key)
+				c.queueResult(msg, nil, ErrQueueDropped)
+				c.inflight.Done()
+			default:
+			}
+		}
+	default:
+		select {
+		case queue <- item:
+			c.registerQueued(item)
+			return nil
+		case <-ctx.Done():
+			c.inflight.Done()
+			return ctx.Err()
+		case <-c.closing:
+			c.inflight.Done()
+			return ErrClientClosed
+		}
+	}
+}
+
+// push waits until there is room in the send queue and adds the item. It returns false if
+// the client is closed.
+func (c *Client) push(item *queueItem) bool {
+	c.closeLock.RLock()
+	defer c.closeLock.RUnlock()
+	if c.closed {
+		return false
+	}
+	if c.replaceQueued(item) {
+		return true
+	}
+	c.inflight.Add(1)
+	select {
+	case c.queueFor(item.msg) <- item:
+		c.registerQueued(item)
+		return true
+	case <-c.closing:
+		c.inflight.Done()
+		return false
+	}
+}
+
+// newQueueItem wraps the message for queueing.
+func (c *Client) newQueueItem(msg *HttpMessage) *queueItem {
+	item := &queueItem{msg: msg}
+	if c.queueConfig.Coalesce && msg.CollapseKey != "" && msg.To != "" {
+		// High and normal priority messages are in different queues.
+		level := "n"
+		if msg.Priority == PriorityHigh {
+			level = "h"
+		}
+		item.coalesce = level + "\x00" + msg.To + "\x00" + msg.CollapseKey
+	}
+	return item
+}
+
+// replaceQueued replaces the message of the queued item with the same coalesce key by the
+// message of the new item. It returns false if there is no such item.
+func (c *Client) replaceQueued(item *queueItem) bool {
+	if item.coalesce == "" {
+		return false
+	}
+
+	c.coalesceLock.Lock()
+	queued, found := c.coalesced[item.coalesce]
+	if !found {
+		c.coalesceLock.Unlock()
+		return false
+	}
+	replaced, key := queued.msg, queued.key
+	queued.msg, queued.key = item.msg, item.key
+	c.coalesceLock.Unlock()
+
+	c.removeOutbox(key)
+	c.queueResult(replaced, nil, ErrQueueCoalesced)
+	return true
+}
+
+// registerQueued makes the item which is in the queue replaceable by later messages with the
+// same coalesce key. Only queued items are registered, so a message is never replaced by one
+// whose caller then fails to queue it.
+func (c *Client) registerQueued(item *queueItem) {
+	if item.coalesce == "" {
+		return
+	}
+
+	c.coalesceLock.Lock()
+	defer c.coalesceLock.Unlock()
+	// A worker may have taken the item already.
+	if _, found := c.coalesced[item.coalesce]; !found && !item.taken {
+		c.coalesced[item.coalesce] = item
+	}
+}
+
+// takeQueued unregisters the item taken from the queue and returns its current message and
+// outbox key.
+func (c *Client) takeQueued(item *queueItem) (*HttpMessage, string) {
+	if item.coalesce == "" {
+		return item.msg, item.key
+	}
+
+	c.coalesceLock.Lock()
+	defer c.coalesceLock.Unlock()
+	item.taken = true
+	if c.coalesced[item.coalesce] == item {
+		delete(c.coalesced, item.coalesce)
+	}
+	return item.msg, item.key
+}
+
+// queueFor returns the queue of the message priority.
+func (c *Client) queueFor(msg *HttpMessage) chan *queueItem {
+	if msg.Priority == PriorityHigh {
+		return c.queueHigh
+	}
+	return c.queue
+}
+
+// QueueLen returns the number of messages waiting in the send queue.
+func (c *Client) QueueLen() int {
+	return len(c.queueHigh) + len(c.queue)
+}
+
+// startQueue starts the workers of the send queue.
+func (c *Client) startQueue(cfg *QueueConfig) {
+	c.queueConfig = cfg
+	c.queueHigh = make(chan *queueItem, cfg.Capacity)
+	c.queue = make(chan *queueItem, cfg.Capacity)
+	c.coalesced = make(map[string]*queueItem)
+	for i := 0; i < cfg.Workers; i++ {
+		go c.workQueue()
+	}
+}
+
+// workQueue sends queued messages until both queues are closed and drained. High priority
+// messages are always taken first.
+func (c *Client) workQueue() {
+	high, normal := c.queueHigh, c.queue
+	for high != nil || normal != nil {
+		var item *queueItem
+		var ok bool
+		select {
+		case item, ok = <-high:
+			if !ok {
+				high = nil
+				continue
+			}
+		default:
+			select {
+			case item, ok = <-high:
+				if !ok {
+					high = nil
+					continue
+				}
+			case item, ok = <-normal:
+				if !ok {
+					normal = nil
+					continue
+				}
+			}
+		}
+		c.runQueued(item)
+	}
+}
+
+func (c *Client) runQueued(item *queueItem) {
+	defer c.endSend()
+
+	msg, key := c.takeQueued(item)
+	resp, err := c.deliver(context.Background(), msg, nil)
+	// The message which failed because the client is closing stays in the outbox.
+	if err == nil || key == "" || !c.isClosing() {
+		c.removeOutbox(key)
+		c.deadLetter(msg, err)
+	}
+	c.queueResult(msg, resp, err)
+}
+
+// queueResult reports the outcome of the queued message.
+func (c *Client) queueResult(msg *HttpMessage, resp *HttpResponse, err error) {
+	if c.queueConfig.OnResult != nil {
+		c.queueConfig.OnResult(msg, resp, err)
+	}
+}
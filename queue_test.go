@@ -0,0 +1,199 @@
+package fcm
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gateServer is a legacy HTTP API server which holds the requests until the gate is opened.
+type gateServer struct {
+	*httptest.Server
+	gate chan struct{}
+
+	mu       sync.Mutex
+	received []*HttpMessage
+}
+
+func newGateServer(t *testing.T) *gateServer {
+	s := &gateServer{gate: make(chan struct{})}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := io.Reader(r.Body)
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			body = zr
+		}
+		var msg HttpMessage
+		if err := json.NewDecoder(body).Decode(&msg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		s.received = append(s.received, &msg)
+		s.mu.Unlock()
+		<-s.gate
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"multicast_id":1,"success":1,"results":[{"message_id":"0:1"}]}`))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// open lets the held and the following requests complete.
+func (s *gateServer) open() {
+	close(s.gate)
+}
+
+// waitReceived waits until the server has received n requests.
+func (s *gateServer) waitReceived(t *testing.T, n int) []*HttpMessage {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mu.Lock()
+		received := append([]*HttpMessage(nil), s.received...)
+		s.mu.Unlock()
+		if len(received) >= n {
+			return received
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("received %d requests, want %d", len(received), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// queueResults collects the outcomes reported to QueueConfig.OnResult.
+type queueResults struct {
+	mu      sync.Mutex
+	results map[string]error
+}
+
+func newQueueResults() *queueResults {
+	return &queueResults{results: make(map[string]error)}
+}
+
+func (r *queueResults) onResult(msg *HttpMessage, resp *HttpResponse, err error) {
+	r.mu.Lock()
+	r.results[msg.To] = err
+	r.mu.Unlock()
+}
+
+func (r *queueResults) get(to string) (error, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err, ok := r.results[to]
+	return err, ok
+}
+
+func TestEnqueueCoalesceAfterCancel(t *testing.T) {
+	srv := newGateServer(t)
+	results := newQueueResults()
+	c := NewClient("key", WithBaseURL(srv.URL), WithQueue(QueueConfig{Workers: 1, Capacity: 1,
+		Coalesce: true, OnResult: results.onResult}))
+
+	// The worker is busy and the queue is full.
+	if err := c.Enqueue(context.Background(), &HttpMessage{To: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	srv.waitReceived(t, 1)
+	if err := c.Enqueue(context.Background(), &HttpMessage{To: "b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first message with the collapse key waits for room and then gives up.
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		first <- c.Enqueue(ctx, &HttpMessage{To: "x", CollapseKey: "k", Data: map[string]string{"n": "1"}})
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// The follow-up must not replace the message which was never queued.
+	second := make(chan error, 1)
+	go func() {
+		second <- c.Enqueue(context.Background(), &HttpMessage{To: "x", CollapseKey: "k", Data: map[string]string{"n": "2"}})
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	if err := <-first; err != context.Canceled {
+		t.Errorf("cancelled Enqueue = %v, want context.Canceled", err)
+	}
+
+	srv.open()
+	if err := <-second; err != nil {
+		t.Errorf("follow-up Enqueue = %v, want nil", err)
+	}
+	if err := c.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	received := srv.waitReceived(t, 3)
+	last := received[len(received)-1]
+	if last.To != "x" || last.Data.(map[string]interface{})["n"] != "2" {
+		t.Errorf("last message = %+v, want the follow-up", last)
+	}
+	if err, ok := results.get("x"); !ok || err != nil {
+		t.Errorf("follow-up result = %v, %v, want sent", err, ok)
+	}
+}
+
+func TestEnqueuePolicyError(t *testing.T) {
+	srv := newGateServer(t)
+	c := NewClient("key", WithBaseURL(srv.URL),
+		WithQueue(QueueConfig{Workers: 1, Capacity: 1, Policy: QueueError}))
+
+	if err := c.Enqueue(context.Background(), &HttpMessage{To: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	srv.waitReceived(t, 1)
+	if err := c.Enqueue(context.Background(), &HttpMessage{To: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Enqueue(context.Background(), &HttpMessage{To: "c"}); err != ErrQueueFull {
+		t.Errorf("Enqueue to a full queue = %v, want ErrQueueFull", err)
+	}
+
+	srv.open()
+	if err := c.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(srv.waitReceived(t, 2)); n != 2 {
+		t.Errorf("received %d messages, want 2", n)
+	}
+}
+
+func TestEnqueuePolicyDropOldest(t *testing.T) {
+	srv := newGateServer(t)
+	results := newQueueResults()
+	c := NewClient("key", WithBaseURL(srv.URL), WithQueue(QueueConfig{Workers: 1, Capacity: 1,
+		Policy: QueueDropOldest, OnResult: results.onResult}))
+
+	for _, to := range []string{"a", "b", "c"} {
+		if err := c.Enqueue(context.Background(), &HttpMessage{To: to}); err != nil {
+			t.Fatal(err)
+		}
+		if to == "a" {
+			srv.waitReceived(t, 1)
+		}
+	}
+
+	srv.open()
+	if err := c.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err, _ := results.get("b"); err != ErrQueueDropped {
+		t.Errorf("dropped message result = %v, want ErrQueueDropped", err)
+	}
+	if err, ok := results.get("c"); !ok || err != nil {
+		t.Errorf("newest message result = %v, %v, want sent", err, ok)
+	}
+}
@@ -0,0 +1,99 @@
+package fcm
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// WithRateLimit limits the rate of requests to FCM to rps requests per second on average
+// with bursts of up to burst requests. Sends wait for their turn: SendHttp blocks and
+// PostHttp delays the request. Each chunk of SendMulticast and each retry is a separate
+// request. If the context is done while waiting, the send fails with the context error.
+func WithRateLimit(rps float64, burst int) Option {
+	return func(o *clientOptions) {
+		o.rateLimit = rps
+		o.rateBurst = burst
+	}
+}
+
+// rateLimiter is a token bucket.
+type rateLimiter struct {
+	mu sync.Mutex
+	// Tokens added per second.
+	rate  float64
+	burst float64
+	// Available tokens, negative if requests are waiting for tokens.
+	tokens float64
+	// Time when tokens were last updated.
+	last time.Time
+}
+
+func newRateLimiter(rps float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{rate: rps, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// advance adds the tokens accumulated since the last update.
+func (l *rateLimiter) advance(now time.Time) {
+	if elapsed := now.Sub(l.last); elapsed > 0 {
+		l.tokens += elapsed.Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+}
+
+// reserve takes a token and returns the time to wait until it becomes available.
+func (l *rateLimiter) reserve() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.advance(time.Now())
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// cancel returns the token of a request which has not been sent.
+func (l *rateLimiter) cancel() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.advance(time.Now())
+	l.tokens++
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+}
+
+// wait blocks until the request may be sent or the context is done.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	delay := l.reserve()
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		l.cancel()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// waitTurn waits for the rate limiter of the client, if any.
+func (c *Client) waitTurn(ctx context.Context) error {
+	if c.limiter == nil {
+		return nil
+	}
+	return c.limiter.wait(ctx)
+}
@@ -0,0 +1,139 @@
+package fcm
+
+import (
+	"errors"
+)
+
+// TokenActions lists what should be done with the registration tokens after a send.
+type TokenActions struct {
+	// Remove are tokens which are no longer valid and should be deleted.
+	Remove []string
+	// Replace maps old tokens to their canonical registration IDs.
+	Replace map[string]string
+	// Retry are tokens which failed with a transient error and can be resent later.
+	Retry []string
+}
+
+// Analyze matches the results of the response with the tokens the message was sent to
+// and classifies the tokens. The sentTokens must be in the same order as in the message:
+// HttpMessage.RegistrationIds, or a one-element slice with HttpMessage.To.
+// An error is returned if the number of tokens does not match the number of results.
+func (r *HttpResponse) Analyze(sentTokens []string) (TokenActions, error) {
+	var actions TokenActions
+	if len(r.Results) != len(sentTokens) {
+		return actions, errors.New("fcm: number of results does not match the number of tokens")
+	}
+
+	for i, result := range r.Results {
+		token := sentTokens[i]
+		switch {
+		case result.Error == ErrorNotRegistered || result.Error == ErrorInvalidRegistration:
+			actions.Remove = append(actions.Remove, token)
+		case isRetryableCode(result.Error):
+			actions.Retry = append(actions.Retry, token)
+		case result.Error == "" && result.RegistrationId != "" && result.RegistrationId != token:
+			if actions.Replace == nil {
+				actions.Replace = make(map[string]string)
+			}
+			actions.Replace[token] = result.RegistrationId
+		}
+	}
+
+	return actions, nil
+}
+
+// isRetryableCode checks if the per-message error code is transient and the message can be resent later.
+func isRetryableCode(code string) bool {
+	switch code {
+	case ErrorUnavailable, ErrorInternalServerError,
+		ErrorDeviceMessageRateExceeded, ErrorTopicsMessageRateExceeded:
+		return true
+	}
+	return false
+}
+
+// ResultsByToken maps the tokens the message was sent to to their results. The sentTokens must
+// be in the same order as in the message, see Analyze. If the number of tokens does not match
+// the number of results, the extra tokens or results are ignored. If a token was sent more
+// than once, the result of its first occurrence is used.
+func (r *HttpResponse) ResultsByToken(sentTokens []string) map[string]Result {
+	count := len(sentTokens)
+	if len(r.Results) < count {
+		count = len(r.Results)
+	}
+
+	results := make(map[string]Result, count)
+	for i := 0; i < count; i++ {
+		if _, ok := results[sentTokens[i]]; !ok {
+			results[sentTokens[i]] = r.Results[i]
+		}
+	}
+	return results
+}
+
+// FailedTokens returns the tokens which failed with any error. Like RetryableTokens and
+// TokensToRemove, it's only available for responses returned by SendHttp, PostHttp and
+// SendMulticast to messages sent to registration tokens, nil otherwise.
+func (r *HttpResponse) FailedTokens() []string {
+	return r.filterTokens(func(result *Result) bool {
+		return result.Error != ""
+	})
+}
+
+// SuccessfulTokens returns the tokens the message was sent to successfully.
+func (r *HttpResponse) SuccessfulTokens() []string {
+	return r.filterTokens(func(result *Result) bool {
+		return result.Error == ""
+	})
+}
+
+// RetryableTokens returns the tokens which failed with a transient error and can be resent later.
+func (r *HttpResponse) RetryableTokens() []string {
+	return r.filterTokens(func(result *Result) bool {
+		return isRetryableCode(result.Error)
+	})
+}
+
+// TokensToRemove returns the tokens which are no longer valid and should be deleted.
+func (r *HttpResponse) TokensToRemove() []string {
+	return r.filterTokens(func(result *Result) bool {
+		return result.Error == ErrorNotRegistered || result.Error == ErrorInvalidRegistration
+	})
+}
+
+// filterTokens returns the sent tokens with results matching the filter.
+func (r *HttpResponse) filterTokens(match func(*Result) bool) []string {
+	var tokens []string
+	for i := range r.Results {
+		if i >= len(r.tokens) {
+			break
+		}
+		if match(&r.Results[i]) {
+			tokens = append(tokens, r.tokens[i])
+		}
+	}
+	return tokens
+}
+
+// handleResults invokes the result callbacks of the client.
+func (c *Client) handleResults(r *HttpResponse) {
+	if c.onCanonicalID == nil && c.onInvalidToken == nil {
+		return
+	}
+	for i := range r.Results {
+		if i >= len(r.tokens) {
+			break
+		}
+		result := &r.Results[i]
+		switch {
+		case result.Error == ErrorNotRegistered || result.Error == ErrorInvalidRegistration:
+			if c.onInvalidToken != nil {
+				c.onInvalidToken(r.tokens[i], result.Error)
+			}
+		case result.Error == "" && result.RegistrationId != "" && result.RegistrationId != r.tokens[i]:
+			if c.onCanonicalID != nil {
+				c.onCanonicalID(r.tokens[i], result.RegistrationId)
+			}
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package fcm
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Default retry settings.
+const (
+	defaultRetryMaxAttempts     = 3
+	defaultRetryMaxElapsedTime  = time.Minute
+	defaultRetryInitialInterval = time.Second
+	defaultRetryMultiplier      = 2
+	defaultRetryMaxInterval     = 30 * time.Second
+)
+
+// RetryConfig configures retrying of sends which failed with a transient error:
+// HTTP 429 or 5xx, or Unavailable and InternalServerError for all recipients of the message.
+// If only some recipients failed with such errors, the message is re-sent to them alone and
+// the results are merged into the response.
+// If the server sends Retry-After, the next attempt is made after the requested delay,
+// otherwise after a random delay up to the exponentially growing interval, see
+// ExponentialBackoff. Zero values mean defaults.
+type RetryConfig struct {
+	// MaxAttempts is the maximum number of attempts including the first one. Default 3.
+	MaxAttempts int
+	// MaxElapsedTime limits the total time of all attempts and the delays between them.
+	// No attempt is made if it would start past the limit. Default 1 minute.
+	MaxElapsedTime time.Duration
+	// InitialInterval is the interval of the first retry. Default 1 second.
+	InitialInterval time.Duration
+	// Multiplier is the growth factor of the interval for each subsequent retry. Default 2.
+	Multiplier float64
+	// MaxInterval caps the interval. Default 30 seconds.
+	MaxInterval time.Duration
+}
+
+// WithRetry enables retrying of sends which failed with a transient error. Retrying is disabled by default.
+func WithRetry(cfg RetryConfig) Option {
+	return func(o *clientOptions) {
+		if cfg.MaxAttempts <= 0 {
+			cfg.MaxAttempts = defaultRetryMaxAttempts
+		}
+		if cfg.MaxElapsedTime <= 0 {
+			cfg.MaxElapsedTime = defaultRetryMaxElapsedTime
+		}
+		if cfg.InitialInterval <= 0 {
+			cfg.InitialInterval = defaultRetryInitialInterval
+		}
+		if cfg.Multiplier <= 1 {
+			cfg.Multiplier = defaultRetryMultiplier
+		}
+		if cfg.MaxInterval <= 0 {
+			cfg.MaxInterval = defaultRetryMaxInterval
+		}
+		o.retry = &cfg
+	}
+}
+
+// WithAtLeastOnce makes the client keep retrying sends which failed with a transient error,
+// including network errors, until they succeed or the budget is exhausted: the error of the
+// last attempt is returned only if the next attempt would start past the budget. The delays
+// between attempts are taken from WithRetry or WithRetryPolicy if given, defaults otherwise.
+func WithAtLeastOnce(budget time.Duration) Option {
+	return func(o *clientOptions) {
+		o.atLeastOnce = budget
+	}
+}
+
+// retryPolicy returns the retry policy of the options and the limit of the total time of
+// the send, zero if not limited. The policy is nil if retrying is disabled.
+func (o *clientOptions) retryPolicy() (RetryPolicy, time.Duration) {
+	policy := o.policy
+	var budget time.Duration
+	if o.retry != nil {
+		budget = o.retry.MaxElapsedTime
+		if policy == nil {
+			policy = &ExponentialBackoff{
+				InitialInterval: o.retry.InitialInterval,
+				Multiplier:      o.retry.Multiplier,
+				MaxInterval:     o.retry.MaxInterval,
+				MaxAttempts:     o.retry.MaxAttempts,
+			}
+		}
+	}
+
+	if o.atLeastOnce > 0 {
+		budget = o.atLeastOnce
+		if o.policy == nil {
+			// Only the budget limits the attempts.
+			backoff := &ExponentialBackoff{MaxAttempts: -1}
+			if o.retry != nil {
+				backoff.InitialInterval = o.retry.InitialInterval
+				backoff.Multiplier = o.retry.Multiplier
+				backoff.MaxInterval = o.retry.MaxInterval
+			}
+			policy = backoff
+		}
+	}
+	return policy, budget
+}
+
+// retryState is the progress of retries of one send: the number of attempts made and the
+// time of the first one. Partial retries of the failed tokens continue from it.
+type retryState struct {
+	start    time.Time
+	attempts int
+}
+
+// retryLoop calls try until it reports a non-retryable outcome, the retry policy gives up,
+// the retry budget is exhausted or the context is done. The try returns true if the outcome
+// is retryable, the delay requested by the server, if any, and the error of the attempt.
+func (c *Client) retryLoop(ctx context.Context, state *retryState, try func() (bool, time.Duration, error)) {
+	for {
+		if state.start.IsZero() {
+			state.start = time.Now()
+		}
+		state.attempts++
+		retryable, retryAfter, err := try()
+		if !retryable || !c.retryWait(ctx, state, retryAfter, err) {
+			return
+		}
+	}
+}
+
+// retryWait waits before the next attempt. It returns false if the retry policy gives up,
+// the retry budget is exhausted or the context is done.
+func (c *Client) retryWait(ctx context.Context, state *retryState, retryAfter time.Duration, err error) bool {
+	if c.retry == nil {
+		return false
+	}
+	delay, ok := c.retry.NextDelay(state.attempts, err, retryAfter)
+	if !ok {
+		return false
+	}
+	if c.retryBudget > 0 && time.Since(state.start)+delay > c.retryBudget {
+		return false
+	}
+
+	if c.logger != nil {
+		if retryAfter > 0 {
+			c.logger.Warn("fcm: throttled by server", "retry_after", retryAfter)
+		}
+		c.logger.Info("fcm: retrying", "attempt", state.attempts+1, "delay", delay)
+	}
+	if obs, ok := c.observer.(RetryObserver); ok {
+		obs.OnRetry(state.attempts+1, delay)
+	}
+	if c.stats != nil {
+		c.stats.Add(ExpvarRetries, 1)
+	}
+
+	timer := time.NewTimer(delay)
+	select {
+	case <-ctx.Done():
+		timer.Stop()
+		return false
+	case <-c.closing:
+		// Don't delay shutdown.
+		timer.Stop()
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// retryableError checks if the request has failed with a transient error and should be retried:
+// the server responded with 429 or 5xx or, in the at-least-once mode, no response was received
+// while the context is not done.
+func (c *Client) retryableError(ctx context.Context, statusCode int, err error) bool {
+	if err == nil {
+		return false
+	}
+	if statusCode == 0 {
+		return c.atLeastOnce && ctx.Err() == nil
+	}
+	return retryableStatus(statusCode)
+}
+
+// retryableStatus checks if the HTTP status code indicates a transient failure.
+func retryableStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+}
@@ -0,0 +1,106 @@
+package fcm
+
+import (
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy decides if and when a send which failed with a transient error is retried,
+// see WithRetryPolicy. Implementations must be safe for concurrent use.
+type RetryPolicy interface {
+	// NextDelay is called after the given number of failed attempts, counting from 1, with
+	// the error of the last attempt and the delay requested by the server with Retry-After,
+	// zero if none. It returns the delay before the next attempt or false to give up.
+	NextDelay(attempt int, err error, retryAfter time.Duration) (time.Duration, bool)
+}
+
+// WithRetryPolicy enables retrying of sends which failed with a transient error using the
+// policy. If WithRetry is also given, the policy replaces its delays and MaxAttempts, and
+// MaxElapsedTime still applies.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(o *clientOptions) {
+		o.policy = policy
+	}
+}
+
+// ExponentialBackoff is a RetryPolicy with full-jitter exponential backoff: the delay is
+// random between zero and the interval which grows by Multiplier after each attempt up to
+// MaxInterval. The delay requested by the server is used as is. Zero values mean defaults.
+type ExponentialBackoff struct {
+	// InitialInterval is the interval of the first retry. Default 1 second.
+	InitialInterval time.Duration
+	// Multiplier is the growth factor of the interval. Default 2.
+	Multiplier float64
+	// MaxInterval caps the interval. Default 30 seconds.
+	MaxInterval time.Duration
+	// MaxAttempts is the maximum number of attempts including the first one. Default 3,
+	// negative means no limit.
+	MaxAttempts int
+}
+
+// NextDelay returns a random delay up to the exponentially growing interval.
+func (b *ExponentialBackoff) NextDelay(attempt int, err error, retryAfter time.Duration) (time.Duration, bool) {
+	if maxAttemptsReached(b.MaxAttempts, attempt) {
+		return 0, false
+	}
+	if retryAfter > 0 {
+		return retryAfter, true
+	}
+
+	initial, multiplier, max := b.InitialInterval, b.Multiplier, b.MaxInterval
+	if initial <= 0 {
+		initial = defaultRetryInitialInterval
+	}
+	if multiplier <= 1 {
+		multiplier = defaultRetryMultiplier
+	}
+	if max <= 0 {
+		max = defaultRetryMaxInterval
+	}
+	interval := float64(initial)
+	for i := 1; i < attempt && interval < float64(max); i++ {
+		interval *= multiplier
+	}
+	if interval > float64(max) {
+		interval = float64(max)
+	}
+	return time.Duration(rand.Int63n(int64(interval) + 1)), true
+}
+
+// FixedBackoff is a RetryPolicy which waits the same Interval between attempts unless the
+// server requests a different delay.
+type FixedBackoff struct {
+	Interval time.Duration
+	// MaxAttempts is the maximum number of attempts including the first one. Default 3,
+	// negative means no limit.
+	MaxAttempts int
+}
+
+// NextDelay returns the Interval or the delay requested by the server.
+func (b *FixedBackoff) NextDelay(attempt int, err error, retryAfter time.Duration) (time.Duration, bool) {
+	if maxAttemptsReached(b.MaxAttempts, attempt) {
+		return 0, false
+	}
+	if retryAfter > 0 {
+		return retryAfter, true
+	}
+	return b.Interval, true
+}
+
+// maxAttemptsReached checks if the number of attempts made has reached the limit,
+// defaultRetryMaxAttempts if zero and none if negative.
+func maxAttemptsReached(max, attempt int) bool {
+	if max == 0 {
+		max = defaultRetryMaxAttempts
+	}
+	return max > 0 && attempt >= max
+}
+
+// NoRetry is a RetryPolicy which never retries.
+var NoRetry RetryPolicy = noRetry{}
+
+type noRetry struct{}
+
+func (noRetry) NextDelay(int, error, time.Duration) (time.Duration, bool) {
+	return 0, false
+}
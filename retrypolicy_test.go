@@ -0,0 +1,32 @@
+package fcm
+
+import "testing"
+
+func TestRetryPolicyMaxAttempts(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		policy RetryPolicy
+		want   int
+	}{
+		{"fixed default", &FixedBackoff{}, defaultRetryMaxAttempts},
+		{"fixed limit", &FixedBackoff{MaxAttempts: 5}, 5},
+		{"exponential default", &ExponentialBackoff{InitialInterval: 1}, defaultRetryMaxAttempts},
+		{"exponential limit", &ExponentialBackoff{InitialInterval: 1, MaxAttempts: 2}, 2},
+	} {
+		attempts := 1
+		for ; attempts < 100; attempts++ {
+			if _, ok := tc.policy.NextDelay(attempts, nil, 0); !ok {
+				break
+			}
+		}
+		if attempts != tc.want {
+			t.Errorf("%s: gave up after %d attempts, want %d", tc.name, attempts, tc.want)
+		}
+	}
+
+	for attempt := 1; attempt < 100; attempt++ {
+		if _, ok := (&FixedBackoff{MaxAttempts: -1}).NextDelay(attempt, nil, 0); !ok {
+			t.Fatalf("unlimited policy gave up after %d attempts", attempt)
+		}
+	}
+}
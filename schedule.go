@@ -0,0 +1,175 @@
+package fcm
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ScheduledSend is a message scheduled for future delivery with Schedule or After.
+type ScheduledSend struct {
+	msg *HttpMessage
+	at  time.Time
+	// Index in the scheduler heap, -1 once the message is due or canceled.
+	index int
+	s     *scheduler
+}
+
+// Time returns the time the message is due.
+func (ss *ScheduledSend) Time() time.Time {
+	return ss.at
+}
+
+// Cancel removes the message from the schedule. It returns false if the message is already
+// due or canceled.
+func (ss *ScheduledSend) Cancel() bool {
+	ss.s.mu.Lock()
+	defer ss.s.mu.Unlock()
+	if ss.index < 0 {
+		return false
+	}
+	heap.Remove(&ss.s.pending, ss.index)
+	ss.s.wakeup()
+	return true
+}
+
+// Schedule queues the message for delivery at the given time. Due messages are pushed into
+// the send queue as if with Enqueue, so the client must be configured with WithQueue and
+// the outcome of the send is reported to QueueConfig.OnResult. Messages which are not due
+// by Close are reported with ErrClientClosed. The message must not be modified afterwards.
+func (c *Client) Schedule(msg *HttpMessage, at time.Time) (*ScheduledSend, error) {
+	if c.queue == nil {
+		return nil, errors.New("fcm: send queue is not configured")
+	}
+	if err := c.checkMessage(msg); err != nil {
+		return nil, err
+	}
+
+	// Close stops the scheduler while holding the lock.
+	c.closeLock.RLock()
+	defer c.closeLock.RUnlock()
+	if c.closed {
+		return nil, ErrClientClosed
+	}
+
+	c.schedulerOnce.Do(func() {
+		c.scheduler = &scheduler{wake: make(chan struct{}, 1)}
+		// Close waits until the pending messages are reported.
+		c.inflight.Add(1)
+		go c.runScheduler()
+	})
+
+	ss := &ScheduledSend{msg: msg, at: at, s: c.scheduler}
+	c.scheduler.mu.Lock()
+	heap.Push(&c.scheduler.pending, ss)
+	c.scheduler.wakeup()
+	c.scheduler.mu.Unlock()
+	return ss, nil
+}
+
+// After is the same as Schedule with the message due after the delay.
+func (c *Client) After(msg *HttpMessage, delay time.Duration) (*ScheduledSend, error) {
+	return c.Schedule(msg, time.Now().Add(delay))
+}
+
+// scheduler keeps scheduled messages ordered by the due time. A single go routine waits
+// for the earliest of them.
+type scheduler struct {
+	mu      sync.Mutex
+	pending scheduleHeap
+	// Signals the go routine that the earliest due time may have changed.
+	wake chan struct{}
+}
+
+// wakeup signals the scheduler go routine. It must be called with mu locked.
+func (s *scheduler) wakeup() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next pops the message which is due, if any, or returns the delay until the earliest
+// message is due, -1 if there are no messages.
+func (s *scheduler) next() (*ScheduledSend, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.pending) == 0 {
+		return nil, -1
+	}
+	if delay := time.Until(s.pending[0].at); delay > 0 {
+		return nil, delay
+	}
+	return heap.Pop(&s.pending).(*ScheduledSend), 0
+}
+
+func (c *Client) runScheduler() {
+	defer c.endSend()
+
+	s := c.scheduler
+	for {
+		ss, delay := s.next()
+		if ss != nil {
+			if err := c.Enqueue(context.Background(), ss.msg); err != nil {
+				c.queueResult(ss.msg, nil, err)
+			}
+			continue
+		}
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		if delay > 0 {
+			timer = time.NewTimer(delay)
+			timeout = timer.C
+		}
+		select {
+		case <-s.wake:
+		case <-timeout:
+		case <-c.closing:
+			s.mu.Lock()
+			pending := s.pending
+			s.pending = nil
+			for _, ss := range pending {
+				ss.index = -1
+			}
+			s.mu.Unlock()
+			for _, ss := range pending {
+				c.queueResult(ss.msg, nil, ErrClientClosed)
+			}
+			return
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// scheduleHeap is a min-heap of scheduled messages ordered by the due time.
+type scheduleHeap []*ScheduledSend
+
+func (h scheduleHeap) Len() int           { return len(h) }
+func (h scheduleHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+
+func (h scheduleHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *scheduleHeap) Push(x interface{}) {
+	ss := x.(*ScheduledSend)
+	ss.index = len(*h)
+	*h = append(*h, ss)
+}
+
+func (h *scheduleHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	ss := old[n-1]
+	old[n-1] = nil
+	ss.index = -1
+	*h = old[:n-1]
+	return ss
+}
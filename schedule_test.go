@@ -0,0 +1,48 @@
+package fcm
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSchedule(t *testing.T) {
+	srv := newGateServer(t)
+	srv.open()
+	results := newQueueResults()
+	c := NewClient("key", WithBaseURL(srv.URL), WithQueue(QueueConfig{Workers: 1, OnResult: results.onResult}))
+
+	if _, err := c.After(&HttpMessage{To: "late"}, 60*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	canceled, err := c.After(&HttpMessage{To: "canceled"}, 30*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.After(&HttpMessage{To: "early"}, 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.After(&HttpMessage{To: "never"}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if !canceled.Cancel() {
+		t.Fatal("Cancel = false, want true")
+	}
+
+	received := srv.waitReceived(t, 2)
+	if err := c.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 2 || received[0].To != "early" || received[1].To != "late" {
+		t.Errorf("received %+v, want early and late in order", received)
+	}
+	if _, ok := results.get("canceled"); ok {
+		t.Error("canceled message was reported")
+	}
+	if err, _ := results.get("never"); err != ErrClientClosed {
+		t.Errorf("result of the message due after Close = %v, want ErrClientClosed", err)
+	}
+	if canceled.Cancel() {
+		t.Error("second Cancel = true, want false")
+	}
+}
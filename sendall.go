@@ -0,0 +1,39 @@
+package fcm
+
+import (
+	"context"
+	"sync"
+)
+
+// SendAll sends independent messages with at most concurrency sends at the same time, all
+// at once if concurrency is not positive. Results are in the order of msgs: results[i] is
+// the outcome of msgs[i]. Once the context is done, the messages which have not been sent
+// yet fail with the context error.
+func (c *Client) SendAll(ctx context.Context, msgs []*HttpMessage, concurrency int) []PostResult {
+	results := make([]PostResult, len(msgs))
+	if concurrency <= 0 || concurrency > len(msgs) {
+		concurrency = len(msgs)
+	}
+	sem := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for i, msg := range msgs {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			results[i].Err = ctx.Err()
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, msg *HttpMessage) {
+			defer wg.Done()
+			resp, err := c.SendHttpContext(ctx, msg)
+			results[i] = PostResult{Response: resp, Err: err}
+			<-sem
+		}(i, msg)
+	}
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,88 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// MulticastMessage is an HTTP v1 API message addressed to multiple registration tokens,
+// see SendEachForMulticast.
+type MulticastMessage struct {
+	Tokens       []string
+	Data         map[string]string
+	Notification *V1Notification
+	Android      *AndroidConfig
+	Apns         *ApnsConfig
+	Webpush      *WebpushConfig
+	FcmOptions   *FcmOptions
+}
+
+// SendEach sends up to MaxBatchSize HTTP v1 API messages with a separate request for each
+// message, so a message rejected by the server does not affect the others. The requests are
+// sent concurrently, see WithMulticastConcurrency. The client must be created with
+// NewClientV1. The returned error is non-nil only if the messages could not be sent at all,
+// failures of individual messages are reported in BatchResponse.
+func (c *Client) SendEach(ctx context.Context, msgs []*Message) (*BatchResponse, error) {
+	if c.tokens == nil {
+		return nil, errors.New("fcm: client is not configured for HTTP v1 API")
+	}
+	if len(msgs) == 0 {
+		return nil, errors.New("fcm: no messages to send")
+	}
+	if len(msgs) > MaxBatchSize {
+		return nil, errors.New("fcm: too many messages")
+	}
+
+	resp := &BatchResponse{Responses: make([]BatchResult, len(msgs))}
+
+	concurrency := c.multicastConcurrency
+	if concurrency <= 0 || concurrency > len(msgs) {
+		concurrency = len(msgs)
+	}
+	sem := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for i, msg := range msgs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, msg *Message) {
+			defer wg.Done()
+			r, err := c.SendV1Context(ctx, msg)
+			resp.Responses[i] = BatchResult{Response: r, Err: err}
+			<-sem
+		}(i, msg)
+	}
+	wg.Wait()
+
+	for _, r := range resp.Responses {
+		if r.Err == nil {
+			resp.SuccessCount++
+		} else {
+			resp.FailureCount++
+		}
+	}
+	return resp, nil
+}
+
+// SendEachForMulticast sends the message to each of up to MaxBatchSize tokens with a separate
+// request, the same way as SendEach. Responses are in the order of msg.Tokens.
+func (c *Client) SendEachForMulticast(ctx context.Context, msg *MulticastMessage) (*BatchResponse, error) {
+	if len(msg.Tokens) == 0 {
+		return nil, errors.New("fcm: no registration tokens")
+	}
+
+	msgs := make([]*Message, len(msg.Tokens))
+	for i, token := range msg.Tokens {
+		msgs[i] = &Message{
+			Token:        token,
+			Data:         msg.Data,
+			Notification: msg.Notification,
+			Android:      msg.Android,
+			Apns:         msg.Apns,
+			Webpush:      msg.Webpush,
+			FcmOptions:   msg.FcmOptions,
+		}
+	}
+	return c.SendEach(ctx, msgs)
+}
@@ -0,0 +1,13 @@
+package fcm
+
+import (
+	"context"
+)
+
+// Sender sends legacy HTTP API messages. It's implemented by *Client and can be replaced
+// with a mock in tests of the code which sends push notifications.
+type Sender interface {
+	SendHttpContext(ctx context.Context, msg *HttpMessage) (*HttpResponse, error)
+}
+
+var _ Sender = (*Client)(nil)
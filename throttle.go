@@ -0,0 +1,286 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ThrottleStore counts sends in fixed time windows for throttling. An implementation backed by
+// a shared database, e.g. Redis, lets multiple processes share the limits.
+type ThrottleStore interface {
+	// Increment adds one to the counter of the key in the current window of the given length.
+	// It returns the new value of the counter and the time when the window ends.
+	Increment(ctx context.Context, key string, window time.Duration) (count int, reset time.Time, err error)
+}
+
+// ThrottleAction is what is done with a message which exceeds the limit.
+type ThrottleAction int
+
+const (
+	// ThrottleDelay delays the send until the window allows it.
+	ThrottleDelay ThrottleAction = iota
+	// ThrottleCollapse drops the message to the throttled device. It's reported in the response
+	// as failed with ErrorDeviceMessageRateExceeded, like a message throttled by FCM, so the
+	// application can resend the latest state later.
+	ThrottleCollapse
+)
+
+// DeviceThrottleConfig configures per-device throttling, see WithDeviceThrottle.
+type DeviceThrottleConfig struct {
+	// Limit is the maximum number of messages to a device in the window.
+	Limit int
+	// Window is the length of the counting window, e.g. one minute.
+	Window time.Duration
+	// Action is applied to messages over the limit. Default ThrottleDelay.
+	Action ThrottleAction
+	// Store keeps the counters. Default is an in-memory store of the client.
+	Store ThrottleStore
+}
+
+// WithDeviceThrottle limits the number of messages SendHttp, PostHttp and SendMulticast send
+// to each registration token in a time window, to avoid DeviceMessageRateExceeded errors.
+// Messages over the limit are delayed or collapsed depending on the Action. If the store
+// fails, messages are sent without throttling. Non-positive Limit or Window disables the
+// throttling.
+func WithDeviceThrottle(cfg DeviceThrottleConfig) Option {
+	return func(o *clientOptions) {
+		if cfg.Limit <= 0 || cfg.Window <= 0 {
+			o.deviceThrottle = nil
+			return
+		}
+		if cfg.Store == nil {
+			cfg.Store = NewMemoryThrottleStore()
+		}
+		o.deviceThrottle = &cfg
+	}
+}
+
+// throttleDevices applies per-device throttling to the message. It returns the message to send,
+// possibly with fewer tokens or nil if there are no tokens left, and the tokens which
+// were collapsed.
+func (c *Client) throttleDevices(ctx context.Context, msg *HttpMessage) (*HttpMessage, []string, error) {
+	cfg := c.deviceThrottle
+	tokens := messageTokens(msg)
+	if cfg == nil || len(tokens) == 0 {
+		return msg, nil, nil
+	}
+
+	var allowed, collapsed []string
+	for _, token := range tokens {
+		ok, err := c.throttle(ctx, cfg.Store, "device:"+token, cfg.Limit, cfg.Window, cfg.Action == ThrottleDelay)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			allowed = append(allowed, token)
+		} else {
+			collapsed = append(collapsed, token)
+		}
+	}
+
+	if len(collapsed) == 0 {
+		return msg, nil, nil
+	}
+	if len(allowed) == 0 {
+		return nil, collapsed, nil
+	}
+	// Only multicast messages may have some of the tokens collapsed.
+	throttled := *msg
+	throttled.RegistrationIds = allowed
+	return &throttled, collapsed, nil
+}
+
+// throttle counts the send to the key. It returns false if the limit is exceeded and the send
+// should not be made. If wait is true, it waits for the next window instead. Errors of the store
+// are logged and ignored, only the context errors are returned.
+func (c *Client) throttle(ctx context.Context, store ThrottleStore, key string, limit int,
+	window time.Duration, wait bool) (bool, error) {
+
+	for {
+		count, reset, err := store.Increment(ctx, key, window)
+		if err != nil {
+			if ctx.Err() != nil {
+				return false, ctx.Err()
+			}
+			if c.logger != nil {
+				c.logger.Warn("fcm: throttle store failed", "key", key, "error", err)
+			}
+			return true, nil
+		}
+		if count <= limit {
+			return true, nil
+		}
+		if !wait {
+			return false, nil
+		}
+
+		timer := time.NewTimer(time.Until(reset))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// collapsedResponse merges the results of the collapsed tokens into the response. The results
+// are ordered as the tokens of the original message.
+func collapsedResponse(resp *HttpResponse, tokens, collapsed []string) *HttpResponse {
+	if resp == nil {
+		resp = &HttpResponse{}
+	}
+	isCollapsed := make(map[string]bool, len(collapsed))
+	for _, token := range collapsed {
+		isCollapsed[token] = true
+	}
+
+	sent := resp.Results
+	results := make([]Result, 0, len(tokens))
+	for _, token := range tokens {
+		if isCollapsed[token] {
+			results = append(results, Result{Error: ErrorDeviceMessageRateExceeded})
+			resp.Fail++
+		} else if len(sent) > 0 {
+			results = append(results, sent[0])
+			sent = sent[1:]
+		}
+	}
+	resp.Results = results
+	return resp
+}
+
+// MemoryThrottleStore is an in-memory ThrottleStore.
+type MemoryThrottleStore struct {
+	mu      sync.Mutex
+	windows map[string]*throttleWindow
+	// Number of increments since the last removal of expired windows.
+	increments int
+}
+
+type throttleWindow struct {
+	count int
+	reset time.Time
+}
+
+// Expired windows are removed after this many increments.
+const throttleSweepInterval = 1000
+
+// NewMemoryThrottleStore creates an empty in-memory store.
+func NewMemoryThrottleStore() *MemoryThrottleStore {
+	return &MemoryThrottleStore{windows: make(map[string]*throttleWindow)}
+}
+
+// Increment implements ThrottleStore.
+func (s *MemoryThrottleStore) Increment(ctx context.Context, key string, window time.Duration) (int, time.Time, error) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.increments++
+	if s.increments >= throttleSweepInterval {
+		s.increments = 0
+		for k, w := range s.windows {
+			if !now.Before(w.reset) {
+				delete(s.windows, k)
+			}
+		}
+	}
+
+	w := s.windows[key]
+	if w == nil || !now.Before(w.reset) {
+		w = &throttleWindow{reset: now.Add(window)}
+		s.windows[key] = w
+	}
+	w.count++
+	return w.count, w.reset, nil
+}
+
+// ErrTopicQueueFull is returned when too many messages to the topic wait for the throttle.
+var ErrTopicQueueFull = errors.New("fcm: topic send queue is full")
+
+// TopicThrottleConfig configures per-topic throttling, see WithTopicThrottle.
+type TopicThrottleConfig struct {
+	// Limit is the maximum number of messages to a topic in the window.
+	Limit int
+	// Window is the length of the counting window.
+	Window time.Duration
+	// MaxQueued limits the number of messages to a topic waiting for the next window.
+	// Zero means no limit.
+	MaxQueued int
+	// Store keeps the counters. Default is an in-memory store of the client.
+	Store ThrottleStore
+}
+
+// WithTopicThrottle limits the number of messages sent to each topic in a time window,
+// to avoid TopicsMessageRateExceeded errors. It applies to SendHttp messages with the topic
+// in To and to SendV1 messages with Topic set. Messages over the limit are queued and sent
+// in order when the window allows, the calls block meanwhile. If MaxQueued messages are
+// already waiting, the send fails with ErrTopicQueueFull. Non-positive Limit or Window
+// disables the throttling.
+func WithTopicThrottle(cfg TopicThrottleConfig) Option {
+	return func(o *clientOptions) {
+		if cfg.Limit <= 0 || cfg.Window <= 0 {
+			o.topicThrottle = nil
+			return
+		}
+		if cfg.Store == nil {
+			cfg.Store = NewMemoryThrottleStore()
+		}
+		o.topicThrottle = &cfg
+	}
+}
+
+// topicQueue orders sends to one topic.
+type topicQueue struct {
+	// Holds a value while a send is waiting for the throttle.
+	turn chan struct{}
+	// Number of sends in the queue, guarded by Client.topicLock. The queue is removed
+	// when the last one leaves.
+	waiting int
+}
+
+// throttleTopic waits until the message to the topic may be sent.
+func (c *Client) throttleTopic(ctx context.Context, topic string) error {
+	cfg := c.topicThrottle
+	if cfg == nil || topic == "" {
+		return nil
+	}
+	topic = strings.TrimPrefix(topic, topicPrefix)
+
+	c.topicLock.Lock()
+	q := c.topicQueues[topic]
+	if q == nil {
+		q = &topicQueue{turn: make(chan struct{}, 1)}
+		c.topicQueues[topic] = q
+	}
+	if cfg.MaxQueued > 0 && q.waiting >= cfg.MaxQueued {
+		c.topicLock.Unlock()
+		return ErrTopicQueueFull
+	}
+	q.waiting++
+	c.topicLock.Unlock()
+
+	defer func() {
+		c.topicLock.Lock()
+		if q.waiting--; q.waiting == 0 {
+			delete(c.topicQueues, topic)
+		}
+		c.topicLock.Unlock()
+	}()
+
+	// Only one send at a time waits for the window, the others wait for their turn.
+	select {
+	case q.turn <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-q.turn }()
+
+	_, err := c.throttle(ctx, cfg.Store, "topic:"+topic, cfg.Limit, cfg.Window, true)
+	return err
+}
@@ -0,0 +1,97 @@
+package fcm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+// Instance ID API endpoint for token info, the token is appended to the path.
+const iidInfoPath = "/iid/info/"
+
+// TokenInfo is information about a registration token returned by the Instance ID API.
+type TokenInfo struct {
+	// Application is the package name or bundle ID of the app, e.g. "com.example.app".
+	Application        string `json:"application"`
+	ApplicationVersion string `json:"applicationVersion,omitempty"`
+	// AuthorizedEntity is the sender ID (project number) authorized to send to the token.
+	AuthorizedEntity string `json:"authorizedEntity"`
+	// Platform is ANDROID, IOS, or CHROME.
+	Platform       string `json:"platform"`
+	AppSigner      string `json:"appSigner,omitempty"`
+	AttestStatus   string `json:"attestStatus,omitempty"`
+	ConnectionType string `json:"connectionType,omitempty"`
+	ConnectDate    string `json:"connectDate,omitempty"`
+	// Rel lists topics the token is subscribed to.
+	Rel *TokenRelations `json:"rel,omitempty"`
+}
+
+// TokenRelations are relations of the registration token.
+type TokenRelations struct {
+	// Topics maps topic names to subscription details.
+	Topics map[string]TopicSubscription `json:"topics,omitempty"`
+}
+
+// TopicSubscription describes a subscription of a token to a topic.
+type TopicSubscription struct {
+	// AddDate is the date of subscription in YYYY-MM-DD format.
+	AddDate string `json:"addDate"`
+}
+
+// GetTokenInfo returns the details of the registration token including topic subscriptions.
+func (c *Client) GetTokenInfo(token string) (*TokenInfo, error) {
+	return c.GetTokenInfoContext(context.Background(), token)
+}
+
+// GetTokenInfoContext is the same as GetTokenInfo but the request is bound to the given context.
+func (c *Client) GetTokenInfoContext(ctx context.Context, token string) (_ *TokenInfo, err error) {
+	if token == "" {
+		return nil, errors.New("fcm: registration token is empty")
+	}
+	if err := c.startSend(); err != nil {
+		return nil, err
+	}
+	defer c.endSend()
+
+	var statusCode int
+	ctx, end := c.startSpan(ctx, "fcm.GetTokenInfo")
+	defer func() { end(statusCode, err) }()
+
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	auth, err := c.authorization(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, c.iidURL+iidInfoPath+url.PathEscape(token)+"?details=true", nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(c.withClientTrace(ctx))
+	req.Header.Add(http.CanonicalHeaderKey("Authorization"), auth)
+	if c.tokens != nil {
+		// Required by the Instance ID API to accept OAuth2 access tokens.
+		req.Header.Add(http.CanonicalHeaderKey("access_token_auth"), "true")
+	}
+
+	c.addHeaders(req)
+	httpResp, body, err := roundTrip(c.connection, req)
+	if err != nil {
+		return nil, err
+	}
+	statusCode = httpResp.StatusCode
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, newHttpError(httpResp, body)
+	}
+
+	var info TokenInfo
+	if err = json.Unmarshal(body, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
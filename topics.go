@@ -0,0 +1,196 @@
+package fcm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+const (
+	// Instance ID API endpoints for managing topic subscriptions.
+	iidBatchAddPath    = "/iid/v1:batchAdd"
+	iidBatchRemovePath = "/iid/v1:batchRemove"
+
+	topicPrefix = "/topics/"
+)
+
+// TopicManagementResponse is the result of a topic subscription management call.
+type TopicManagementResponse struct {
+	SuccessCount int
+	FailureCount int
+	// Results are aligned with the tokens passed to the call: Results[i] is the outcome for tokens[i].
+	Results []TopicManagementResult
+}
+
+// TopicManagementResult is the outcome of the topic management operation for one token.
+type TopicManagementResult struct {
+	Token string
+	// Error is the error reported by the server, such as NOT_FOUND or INVALID_ARGUMENT, empty on success.
+	Error string
+}
+
+// Success returns true if the operation succeeded for the token.
+func (r *TopicManagementResult) Success() bool {
+	return r.Error == ""
+}
+
+// SubscribeToTopic subscribes the registration tokens to the topic. The topic name may be
+// given with or without the leading "/topics/" prefix. Lists longer than MaxRegistrationIds
+// are split into multiple calls. If a call fails, its tokens are reported as failed with the
+// error message. An error is returned only if all calls have failed.
+func (c *Client) SubscribeToTopic(topic string, tokens []string) (*TopicManagementResponse, error) {
+	return c.SubscribeToTopicContext(context.Background(), topic, tokens)
+}
+
+// SubscribeToTopicContext is the same as SubscribeToTopic but the request is bound to the given context.
+func (c *Client) SubscribeToTopicContext(ctx context.Context, topic string,
+	tokens []string) (*TopicManagementResponse, error) {
+	return c.manageTopic(ctx, "fcm.SubscribeToTopic", iidBatchAddPath, topic, tokens)
+}
+
+// UnsubscribeFromTopic unsubscribes the registration tokens from the topic. The topic name may be
+// given with or without the leading "/topics/" prefix. Long lists are handled the same way
+// as in SubscribeToTopic.
+func (c *Client) UnsubscribeFromTopic(topic string, tokens []string) (*TopicManagementResponse, error) {
+	return c.UnsubscribeFromTopicContext(context.Background(), topic, tokens)
+}
+
+// UnsubscribeFromTopicContext is the same as UnsubscribeFromTopic but the request is bound to the given context.
+func (c *Client) UnsubscribeFromTopicContext(ctx context.Context, topic string,
+	tokens []string) (*TopicManagementResponse, error) {
+	return c.manageTopic(ctx, "fcm.UnsubscribeFromTopic", iidBatchRemovePath, topic, tokens)
+}
+
+func (c *Client) manageTopic(ctx context.Context, operation, path, topic string,
+	tokens []string) (resp *TopicManagementResponse, err error) {
+
+	if err := ValidateTopic(topic); err != nil {
+		return nil, err
+	}
+	topic = strings.TrimPrefix(topic, topicPrefix)
+	if len(tokens) == 0 {
+		return nil, errors.New("fcm: no registration tokens")
+	}
+	if err := c.checkTokens(tokens...); err != nil {
+		return nil, err
+	}
+	if err := c.startSend(); err != nil {
+		return nil, err
+	}
+	defer c.endSend()
+
+	// HTTP status of the last response.
+	var statusCode int
+	ctx, endSpan := c.startSpan(ctx, operation,
+		Attribute{Key: AttributeTopic, Value: topic},
+		Attribute{Key: AttributeTokens, Value: len(tokens)})
+	defer func() { endSpan(statusCode, err) }()
+
+	// The Instance ID API accepts at most MaxRegistrationIds tokens per call.
+	response := &TopicManagementResponse{Results: make([]TopicManagementResult, 0, len(tokens))}
+	var errs []error
+	chunks := 0
+	for start := 0; start < len(tokens); start += MaxRegistrationIds {
+		chunks++
+		end := start + MaxRegistrationIds
+		if end > len(tokens) {
+			end = len(tokens)
+		}
+		chunk := tokens[start:end]
+
+		errCodes, status, err := c.manageTopicChunk(ctx, path, topic, chunk)
+		if status != 0 {
+			statusCode = status
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+			errs = append(errs, err)
+		}
+		for i, token := range chunk {
+			result := TopicManagementResult{Token: token}
+			if err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Error = errCodes[i]
+			}
+			if result.Error == "" {
+				response.SuccessCount++
+			} else {
+				response.FailureCount++
+			}
+			response.Results = append(response.Results, result)
+		}
+	}
+
+	if len(errs) == chunks {
+		return nil, errors.Join(errs...)
+	}
+
+	return response, nil
+}
+
+// manageTopicChunk issues one Instance ID API call and returns per-token error codes and
+// the HTTP status of the response, zero if none was received.
+func (c *Client) manageTopicChunk(ctx context.Context, path, topic string, tokens []string) ([]string, int, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	payload, err := json.Marshal(map[string]interface{}{
+		"to":                  topicPrefix + topic,
+		"registration_tokens": tokens,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	auth, err := c.authorization(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.iidURL+path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, 0, err
+	}
+	req = req.WithContext(c.withClientTrace(ctx))
+	req.Header.Add(http.CanonicalHeaderKey("Content-Type"), "application/json")
+	req.Header.Add(http.CanonicalHeaderKey("Authorization"), auth)
+	if c.tokens != nil {
+		// Required by the Instance ID API to accept OAuth2 access tokens.
+		req.Header.Add(http.CanonicalHeaderKey("access_token_auth"), "true")
+	}
+
+	c.addHeaders(req)
+	httpResp, body, err := roundTrip(c.connection, req)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if httpResp.StatusCode != http.StatusOK {
+		// Assuming non-JSON response
+		return nil, httpResp.StatusCode, newHttpError(httpResp, body)
+	}
+
+	var raw struct {
+		Results []struct {
+			Error string `json:"error"`
+		} `json:"results"`
+	}
+	if err = json.Unmarshal(body, &raw); err != nil {
+		return nil, httpResp.StatusCode, err
+	}
+	if len(raw.Results) != len(tokens) {
+		return nil, httpResp.StatusCode, errors.New("fcm: number of results does not match the number of tokens")
+	}
+
+	errCodes := make([]string, len(tokens))
+	for i, r := range raw.Results {
+		errCodes[i] = r.Error
+	}
+	return errCodes, httpResp.StatusCode, nil
+}
@@ -0,0 +1,36 @@
+package fcm
+
+import (
+	"context"
+)
+
+// Tracer creates spans for client operations, e.g. with OpenTelemetry, see package otelfcm.
+type Tracer interface {
+	// Start is called when the operation, such as "fcm.SendHttp", begins. The returned context
+	// is used for the requests of the operation. The end function is called once when the
+	// operation completes with the HTTP status code of the last response, zero if none was
+	// received, and the error, if any.
+	Start(ctx context.Context, operation string, attrs ...Attribute) (context.Context, func(statusCode int, err error))
+}
+
+// Attribute is a key-value pair describing the traced operation.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Keys of attributes reported to Tracer.
+const (
+	AttributePriority = "fcm.priority"
+	AttributeTokens   = "fcm.tokens"
+	AttributeMessages = "fcm.messages"
+	AttributeTopic    = "fcm.topic"
+)
+
+// startSpan starts tracing the operation if the client has a tracer.
+func (c *Client) startSpan(ctx context.Context, operation string, attrs ...Attribute) (context.Context, func(int, error)) {
+	if c.tracer == nil {
+		return ctx, func(int, error) {}
+	}
+	return c.tracer.Start(ctx, operation, attrs...)
+}
@@ -0,0 +1,245 @@
+package fcm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Message is an FCM HTTP v1 message. Exactly one of Token, Topic or Condition
+// must be set.
+type Message struct {
+	Token        string            `json:"token,omitempty"`
+	Topic        string            `json:"topic,omitempty"`
+	Condition    string            `json:"condition,omitempty"`
+	Data         map[string]string `json:"data,omitempty"`
+	Notification *V1Notification   `json:"notification,omitempty"`
+	Android      *AndroidConfig    `json:"android,omitempty"`
+	Apns         *ApnsConfig       `json:"apns,omitempty"`
+	Webpush      *WebpushConfig    `json:"webpush,omitempty"`
+	FcmOptions   *FcmOptions       `json:"fcm_options,omitempty"`
+
+	// IdempotencyKey identifies the message for suppressing duplicate sends, see WithDedup.
+	// It's not sent to FCM.
+	IdempotencyKey string `json:"-"`
+}
+
+// FcmOptions is platform-independent options for features provided by the FCM SDKs.
+type FcmOptions struct {
+	// AnalyticsLabel is the label associated with the message's analytics data.
+	AnalyticsLabel string `json:"analytics_label,omitempty"`
+}
+
+// V1Notification is the basic notification template shared by all platforms.
+type V1Notification struct {
+	Title string `json:"title,omitempty"`
+	Body  string `json:"body,omitempty"`
+	Image string `json:"image,omitempty"`
+}
+
+// NewV1Notification converts the platform-independent fields of the legacy notification.
+func NewV1Notification(n *Notification) *V1Notification {
+	return &V1Notification{
+		Title: n.Title,
+		Body:  n.Body,
+		Image: n.Image,
+	}
+}
+
+// priority returns the Android priority of the message, if any.
+func (msg *Message) priority() string {
+	if msg.Android != nil {
+		return msg.Android.Priority
+	}
+	return ""
+}
+
+// V1Response is a response to a successfully sent FCM HTTP v1 message.
+type V1Response struct {
+	// Name is the identifier of the sent message in the format of projects/*/messages/{message_id}.
+	Name string `json:"name"`
+}
+
+// V1Error is an error returned by the FCM HTTP v1 API.
+type V1Error struct {
+	// Code is the HTTP status code.
+	Code int `json:"code"`
+	// Message is a human-readable description of the error.
+	Message string `json:"message"`
+	// Status is a canonical error code such as INVALID_ARGUMENT or UNAVAILABLE.
+	Status  string          `json:"status"`
+	Details []V1ErrorDetail `json:"details,omitempty"`
+
+	// RetryAfter is the value of the Retry-After header, zero if the header is missing.
+	RetryAfter time.Duration `json:"-"`
+}
+
+// V1ErrorDetail is an element of the V1Error details.
+type V1ErrorDetail struct {
+	// Type is the type of the detail, such as "type.googleapis.com/google.firebase.fcm.v1.FcmError".
+	Type string `json:"@type"`
+	// ErrorCode is FCM-specific error code, such as UNREGISTERED or QUOTA_EXCEEDED.
+	ErrorCode string `json:"errorCode,omitempty"`
+	// FieldViolations are reported with google.rpc.BadRequest details.
+	FieldViolations []V1FieldViolation `json:"fieldViolations,omitempty"`
+}
+
+// V1FieldViolation describes a single invalid field of the request.
+type V1FieldViolation struct {
+	Field       string `json:"field"`
+	Description string `json:"description"`
+}
+
+func (e *V1Error) Error() string {
+	if code := e.ErrorCode(); code != "" {
+		return e.Status + " (" + code + "): " + e.Message
+	}
+	return e.Status + ": " + e.Message
+}
+
+// ErrorCode returns FCM-specific error code from error details or an empty string
+// if the error has no such details.
+func (e *V1Error) ErrorCode() string {
+	for _, d := range e.Details {
+		if d.ErrorCode != "" {
+			return d.ErrorCode
+		}
+	}
+	return ""
+}
+
+// SendV1 is a blocking call to send a message using FCM HTTP v1 API. The client must be
+// created with NewClientV1. Failures reported by the server are returned as *V1Error.
+func (c *Client) SendV1(msg *Message) (*V1Response, error) {
+	return c.SendV1Context(context.Background(), msg)
+}
+
+// SendV1Context is the same as SendV1 but the request is bound to the given context.
+func (c *Client) SendV1Context(ctx context.Context, msg *Message) (resp *V1Response, err error) {
+	if c.tokens == nil {
+		return nil, errors.New("fcm: client is not configured for HTTP v1 API")
+	}
+	if err := c.startSend(); err != nil {
+		return nil, err
+	}
+	defer c.endSend()
+
+	if msg.Token != "" {
+		if err := c.checkTokens(msg.Token); err != nil {
+			return nil, err
+		}
+	}
+	sent, err := c.claimKey(msg.IdempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		sent(err)
+		c.deadLetterV1(msg, err)
+	}()
+	if err := c.throttleTopic(ctx, msg.Topic); err != nil {
+		return nil, err
+	}
+
+	buf, err := encodeJSON(map[string]interface{}{"message": msg})
+	if err != nil {
+		return nil, err
+	}
+	defer buf.release()
+
+	var payload requestBody = buf
+	if c.gzip {
+		payload = &gzipBody{payload: buf}
+	}
+
+	ctx, end := c.startSpan(ctx, "fcm.SendV1",
+		Attribute{Key: AttributePriority, Value: msg.priority()},
+		Attribute{Key: AttributeTokens, Value: 1})
+
+	var statusCode int
+	c.retryLoop(ctx, &retryState{}, func() (bool, time.Duration, error) {
+		var retryAfter string
+		resp, statusCode, retryAfter, err = c.postV1(ctx, payload)
+		return c.retryableError(ctx, statusCode, err), parseRetryAfter(retryAfter), err
+	})
+	end(statusCode, err)
+
+	return resp, err
+}
+
+// postV1 issues one HTTP v1 API request. It returns the decoded response, HTTP status code
+// and the value of the Retry-After header.
+func (c *Client) postV1(ctx context.Context, payload requestBody) (resp *V1Response, statusCode int, retryAfter string, err error) {
+	if err := c.waitTurn(ctx); err != nil {
+		return nil, 0, "", err
+	}
+	done, err := c.allowRequest()
+	if err != nil {
+		return nil, 0, "", err
+	}
+	defer func() {
+		done(statusCode, err)
+		c.adaptRate(statusCode, nil)
+	}()
+
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	start := time.Now()
+	defer func() {
+		c.logRequest("v1", payload.size(), statusCode, time.Since(start), err)
+		c.countRequest(payload.size(), err)
+	}()
+
+	auth, err := c.authorization(ctx)
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.fcmURL+fmt.Sprintf(v1SendPath, c.projectID), nil)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	req = req.WithContext(c.withClientTrace(ctx))
+	req = c.setBody(req, payload)
+	req.Header.Add(http.CanonicalHeaderKey("Content-Type"), "application/json")
+	req.Header.Add(http.CanonicalHeaderKey("Authorization"), auth)
+
+	c.addHeaders(req)
+	httpResp, body, err := roundTrip(c.connection, req)
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	retryAfter = httpResp.Header.Get(http.CanonicalHeaderKey("Retry-After"))
+	resp, err = decodeV1Response(httpResp, body)
+
+	return resp, httpResp.StatusCode, retryAfter, err
+}
+
+// decodeV1Response decodes the response to a single HTTP v1 API message.
+func decodeV1Response(httpResp *http.Response, body []byte) (*V1Response, error) {
+	if httpResp.StatusCode != http.StatusOK {
+		var errResp struct {
+			Error *V1Error `json:"error"`
+		}
+		if json.Unmarshal(body, &errResp) == nil && errResp.Error != nil {
+			if errResp.Error.Code == 0 {
+				errResp.Error.Code = httpResp.StatusCode
+			}
+			errResp.Error.RetryAfter = parseRetryAfter(httpResp.Header.Get(http.CanonicalHeaderKey("Retry-After")))
+			return nil, errResp.Error
+		}
+		// Not a structured error
+		return nil, newHttpError(httpResp, body)
+	}
+
+	var response V1Response
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
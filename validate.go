@@ -0,0 +1,165 @@
+package fcm
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxTimeToLive is the maximum time to live of a message supported by FCM, 4 weeks.
+	MaxTimeToLive = 4 * 7 * 24 * time.Hour
+
+	// MaxDataSize is the maximum size of the JSON-encoded data payload in bytes.
+	MaxDataSize = 4096
+	// Limits on the length of a registration token checked by ValidateToken. Actual tokens
+	// are usually 140-200 characters long.
+	minTokenLength = 32
+	maxTokenLength = 4096
+
+	// MaxNotificationSize is the maximum size of the JSON-encoded notification in bytes.
+	MaxNotificationSize = 2048
+)
+
+// PayloadSize is the size of the JSON-encoded message content in bytes, see EstimateSize.
+type PayloadSize struct {
+	Data         int
+	Notification int
+}
+
+// Fits checks if the payload is within FCM limits.
+func (s PayloadSize) Fits() bool {
+	return s.Data <= MaxDataSize && s.Notification <= MaxNotificationSize
+}
+
+// EstimateSize reports the encoded sizes of the data payload and the notification of the
+// message to compare them against MaxDataSize and MaxNotificationSize. Messages over the
+// limits are rejected by FCM with MessageTooBig error.
+func EstimateSize(msg *HttpMessage) (PayloadSize, error) {
+	var size PayloadSize
+	if msg.Data != nil {
+		data, err := json.Marshal(msg.Data)
+		if err != nil {
+			return size, err
+		}
+		size.Data = len(data)
+	}
+	if msg.Notification != nil {
+		notification, err := json.Marshal(msg.Notification)
+		if err != nil {
+			return size, err
+		}
+		size.Notification = len(notification)
+	}
+	return size, nil
+}
+
+// ValidationError is returned when the message is rejected before sending it to FCM.
+type ValidationError struct {
+	// Field is the JSON name of the invalid field, e.g. "time_to_live".
+	Field string
+	// Reason describes the problem.
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	return "fcm: invalid " + e.Field + ": " + e.Reason
+}
+
+// Validate checks the message for errors which would be rejected by FCM: exactly one of
+// To, RegistrationIds or Condition must be set, at most MaxRegistrationIds tokens, time to
+// live up to MaxTimeToLive and data payload up to MaxDataSize bytes. The message is validated
+// automatically before sending. The returned error is *ValidationError.
+func (msg *HttpMessage) Validate() error {
+	targets := 0
+	if msg.To != "" {
+		targets++
+	}
+	if len(msg.RegistrationIds) > 0 {
+		targets++
+	}
+	if msg.Condition != "" {
+		targets++
+	}
+	if targets == 0 {
+		return &ValidationError{Field: "to", Reason: "message has no recipient"}
+	}
+	if targets > 1 {
+		return &ValidationError{Field: "to", Reason: "only one of to, registration_ids or condition may be set"}
+	}
+
+	if len(msg.RegistrationIds) > MaxRegistrationIds {
+		return &ValidationError{Field: "registration_ids", Reason: "too many registration tokens"}
+	}
+	for _, token := range msg.RegistrationIds {
+		if token == "" {
+			return &ValidationError{Field: "registration_ids", Reason: "empty registration token"}
+		}
+	}
+
+	if ttl, ok := msg.TTL(); ok && ttl > MaxTimeToLive {
+		return &ValidationError{Field: "time_to_live", Reason: "exceeds 4 weeks"}
+	}
+
+	size, err := EstimateSize(msg)
+	if err != nil {
+		return &ValidationError{Field: "data", Reason: err.Error()}
+	}
+	if size.Data > MaxDataSize {
+		return &ValidationError{Field: "data", Reason: "payload exceeds 4096 bytes"}
+	}
+
+	return nil
+}
+
+// ValidateToken rejects obviously malformed registration tokens: empty, too short or too long,
+// or containing characters other than letters, digits, '-', '_', ':' and '.'. Passing the
+// check does not mean the token is valid. The returned error is *ValidationError.
+func ValidateToken(token string) error {
+	if token == "" {
+		return &ValidationError{Field: "token", Reason: "registration token is empty"}
+	}
+	if len(token) < minTokenLength || len(token) > maxTokenLength {
+		return &ValidationError{Field: "token", Reason: "registration token has invalid length"}
+	}
+	for _, r := range token {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("-_:.", r):
+		default:
+			return &ValidationError{Field: "token", Reason: "registration token contains invalid characters"}
+		}
+	}
+	return nil
+}
+
+// ValidateTopic checks that the topic name, with or without the "/topics/" prefix, matches
+// FCM's [a-zA-Z0-9-_.~%]+ pattern. The returned error is *ValidationError.
+func ValidateTopic(topic string) error {
+	name := strings.TrimPrefix(topic, topicPrefix)
+	if name == "" {
+		return &ValidationError{Field: "topic", Reason: "topic name is empty"}
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case strings.ContainsRune("-_.~%", r):
+		default:
+			return &ValidationError{Field: "topic", Reason: "invalid topic name '" + name + "'"}
+		}
+	}
+	return nil
+}
+
+// checkTokens validates registration tokens if the client is configured to do so.
+func (c *Client) checkTokens(tokens ...string) error {
+	if !c.validateTokens {
+		return nil
+	}
+	for _, token := range tokens {
+		if err := ValidateToken(token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
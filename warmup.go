@@ -0,0 +1,77 @@
+package fcm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// Warmup establishes up to n connections to each of the servers the client sends to:
+// the legacy HTTP API endpoint, the HTTP v1 API and the Instance ID API, in advance so the
+// first requests don't wait for TCP and TLS handshakes. The connections are kept idle in the pool, which
+// holds at most 2 idle connections unless configured with WithMaxIdleConnsPerHost.
+// Over HTTP/2 a single connection is usually shared by all requests. An error is
+// returned if any of the connections failed.
+func (c *Client) Warmup(ctx context.Context, n int) error {
+	if n <= 0 {
+		return errors.New("fcm: number of connections must be positive")
+	}
+
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	// Concurrent requests make the transport open separate connections.
+	origins := c.warmupOrigins()
+	errs := make([]error, n*len(origins))
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = c.warmupConnection(ctx, origins[i%len(origins)])
+		}(i)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// warmupOrigins returns the distinct scheme and host pairs of the URLs the client sends to.
+func (c *Client) warmupOrigins() []string {
+	var origins []string
+	seen := make(map[string]bool)
+	for _, raw := range []string{c.endpoint, c.fcmURL, c.iidURL} {
+		origin := raw
+		if u, err := url.Parse(raw); err == nil && u.Host != "" {
+			origin = u.Scheme + "://" + u.Host
+		}
+		if !seen[origin] {
+			seen[origin] = true
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// warmupConnection issues a HEAD request to the server. The response status is ignored.
+func (c *Client) warmupConnection(ctx context.Context, origin string) error {
+	req, err := http.NewRequest(http.MethodHead, origin+"/", nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(c.withClientTrace(ctx))
+	c.addHeaders(req)
+
+	resp, err := c.connection.RoundTrip(req)
+	if err != nil {
+		return contextError(ctx, err)
+	}
+	// Read the body to the end so the connection is returned to the pool.
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	return nil
+}
@@ -0,0 +1,34 @@
+package fcm
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWarmupAllHosts(t *testing.T) {
+	newServer := func(heads *int32) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodHead && r.URL.Path == "/" {
+				atomic.AddInt32(heads, 1)
+			}
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+	var legacyHeads, baseHeads int32
+	legacy := newServer(&legacyHeads)
+	base := newServer(&baseHeads)
+
+	c := NewClient("key", WithBaseURL(base.URL), WithEndpoint(legacy.URL+"/proxy/send"))
+	defer c.Close(context.Background())
+	if err := c.Warmup(context.Background(), 2); err != nil {
+		t.Fatal(err)
+	}
+	// The v1 and Instance ID APIs share the base URL.
+	if legacyHeads != 2 || baseHeads != 2 {
+		t.Errorf("warmed up %d legacy and %d base connections, want 2 and 2", legacyHeads, baseHeads)
+	}
+}
@@ -0,0 +1,136 @@
+package fcm
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// Webpush protocol headers, see https://tools.ietf.org/html/rfc8030#section-5
+const (
+	WebpushHeaderTTL     = "TTL"
+	WebpushHeaderUrgency = "Urgency"
+	WebpushHeaderTopic   = "Topic"
+)
+
+// Values of the Urgency header.
+const (
+	WebpushUrgencyVeryLow = "very-low"
+	WebpushUrgencyLow     = "low"
+	WebpushUrgencyNormal  = "normal"
+	WebpushUrgencyHigh    = "high"
+)
+
+// WebpushConfig is Webpush protocol options.
+type WebpushConfig struct {
+	Headers      map[string]string    `json:"headers,omitempty"`
+	Data         map[string]string    `json:"data,omitempty"`
+	Notification *WebpushNotification `json:"notification,omitempty"`
+	FcmOptions   *WebpushFcmOptions   `json:"fcm_options,omitempty"`
+}
+
+// SetHeader sets the Webpush protocol header, e.g. WebpushHeaderTTL.
+func (c *WebpushConfig) SetHeader(key, value string) {
+	if c.Headers == nil {
+		c.Headers = make(map[string]string)
+	}
+	c.Headers[key] = value
+}
+
+// WebpushFcmOptions is options for features provided by the FCM SDK for Web.
+type WebpushFcmOptions struct {
+	// Link is the URL to open when the user clicks on the notification. HTTPS only.
+	Link           string `json:"link,omitempty"`
+	AnalyticsLabel string `json:"analytics_label,omitempty"`
+}
+
+// WebpushNotification is Web Notification options, see
+// https://developer.mozilla.org/en-US/docs/Web/API/Notification/Notification
+type WebpushNotification struct {
+	Title   string                      `json:"title,omitempty"`
+	Body    string                      `json:"body,omitempty"`
+	Icon    string                      `json:"icon,omitempty"`
+	Image   string                      `json:"image,omitempty"`
+	Badge   string                      `json:"badge,omitempty"`
+	Lang    string                      `json:"lang,omitempty"`
+	Tag     string                      `json:"tag,omitempty"`
+	Actions []WebpushNotificationAction `json:"actions,omitempty"`
+	// Direction is "auto", "ltr" or "rtl".
+	Direction          string      `json:"dir,omitempty"`
+	Data               interface{} `json:"data,omitempty"`
+	Renotify           bool        `json:"renotify,omitempty"`
+	RequireInteraction bool        `json:"requireInteraction,omitempty"`
+	Silent             bool        `json:"silent,omitempty"`
+	// Timestamp is milliseconds since the Unix epoch.
+	Timestamp int64 `json:"timestamp,omitempty"`
+	// Vibrate is the vibration pattern in milliseconds.
+	Vibrate []int `json:"vibrate,omitempty"`
+	// CustomData are additional options not covered by the fields above.
+	CustomData map[string]interface{} `json:"-"`
+}
+
+// WebpushNotificationAction is a user action shown in the notification.
+type WebpushNotificationAction struct {
+	Action string `json:"action,omitempty"`
+	Title  string `json:"title,omitempty"`
+	Icon   string `json:"icon,omitempty"`
+}
+
+// MarshalJSON serializes the notification options together with the custom keys.
+func (n WebpushNotification) MarshalJSON() ([]byte, error) {
+	type notification WebpushNotification
+	if len(n.CustomData) == 0 {
+		return json.Marshal(notification(n))
+	}
+
+	raw, err := json.Marshal(notification(n))
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err = json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	for k, v := range n.CustomData {
+		if _, ok := fields[k]; !ok {
+			fields[k] = v
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// UnmarshalJSON decodes the notification options and collects the unknown keys into CustomData.
+func (n *WebpushNotification) UnmarshalJSON(data []byte) error {
+	type notification WebpushNotification
+	if err := json.Unmarshal(data, (*notification)(n)); err != nil {
+		return err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	n.CustomData = nil
+	for k, v := range fields {
+		if webpushNotificationKeys[k] {
+			continue
+		}
+		if n.CustomData == nil {
+			n.CustomData = make(map[string]interface{})
+		}
+		n.CustomData[k] = v
+	}
+	return nil
+}
+
+// webpushNotificationKeys are the JSON keys of the WebpushNotification fields.
+var webpushNotificationKeys = func() map[string]bool {
+	keys := make(map[string]bool)
+	t := reflect.TypeOf(WebpushNotification{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			keys[name] = true
+		}
+	}
+	return keys
+}()
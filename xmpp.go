@@ -0,0 +1,755 @@
+package fcm
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Address of the production XMPP (CCS) server.
+	XmppAddress = "fcm-xmpp.googleapis.com:5235"
+	// Address of the pre-production XMPP server.
+	XmppTestAddress = "fcm-xmpp.googleapis.com:5236"
+
+	// XMPP domain of FCM.
+	xmppDomain = "fcm.googleapis.com"
+	// Namespace of the FCM payload element.
+	xmppGcmNamespace = "google:mobile:data"
+
+	// XmppMaxPending is the maximum number of messages sent on one XMPP connection
+	// which are waiting for ACK or NACK from the server.
+	XmppMaxPending = 100
+)
+
+// Values of the message_type field of XMPP messages.
+const (
+	xmppMessageAck     = "ack"
+	xmppMessageNack    = "nack"
+	xmppMessageControl = "control"
+	xmppMessageReceipt = "receipt"
+
+	xmppControlDraining = "CONNECTION_DRAINING"
+)
+
+// Errors reported in XMPP NACK messages, see XmppError.
+const (
+	XmppErrorBadRegistration           = "BAD_REGISTRATION"
+	XmppErrorDeviceUnregistered        = "DEVICE_UNREGISTERED"
+	XmppErrorBadAck                    = "BAD_ACK"
+	XmppErrorServiceUnavailable        = "SERVICE_UNAVAILABLE"
+	XmppErrorInternalServerError       = "INTERNAL_SERVER_ERROR"
+	XmppErrorDeviceMessageRateExceeded = "DEVICE_MESSAGE_RATE_EXCEEDED"
+	XmppErrorTopicsMessageRateExceeded = "TOPICS_MESSAGE_RATE_EXCEEDED"
+	XmppErrorConnectionDraining        = "CONNECTION_DRAINING"
+	XmppErrorInvalidJson               = "INVALID_JSON"
+)
+
+// ErrXmppClosed is returned when the XMPP connection is closed before the server
+// acknowledged the message. The message may or may not have been delivered.
+var ErrXmppClosed = errors.New("fcm: xmpp connection closed")
+
+// XmppMessage is a downstream message sent over XMPP.
+type XmppMessage struct {
+	// To is a registration token, notification key or a topic "/topics/name".
+	To        string `json:"to,omitempty"`
+	Condition string `json:"condition,omitempty"`
+	// MessageId uniquely identifies the message. It's generated if empty.
+	MessageId             string        `json:"message_id"`
+	CollapseKey           string        `json:"collapse_key,omitempty"`
+	Priority              string        `json:"priority,omitempty"`
+	ContentAvailable      bool          `json:"content_available,omitempty"`
+	TimeToLive            *uint         `json:"time_to_live,omitempty"`
+	RestrictedPackageName string        `json:"restricted_package_name,omitempty"`
+	DryRun                bool          `json:"dry_run,omitempty"`
+	Data                  interface{}   `json:"data,omitempty"`
+	Notification          *Notification `json:"notification,omitempty"`
+	// DeliveryReceiptRequested makes FCM report delivery of the message to the device,
+	// see WithXmppReceiptHandler.
+	DeliveryReceiptRequested bool `json:"delivery_receipt_requested,omitempty"`
+}
+
+// XmppResponse is the ACK of a downstream message.
+type XmppResponse struct {
+	MessageId string
+	// From is the recipient of the message.
+	From string
+	// RegistrationId is the canonical registration token if the token the message was sent
+	// to is outdated. The old token should be replaced with this one.
+	RegistrationId string
+}
+
+// XmppError is the NACK of a downstream message.
+type XmppError struct {
+	MessageId string
+	From      string
+	// Code is one of XmppError* constants.
+	Code        string
+	Description string
+}
+
+func (e *XmppError) Error() string {
+	if e.Description != "" {
+		return "fcm: " + e.Code + ": " + e.Description
+	}
+	return "fcm: " + e.Code
+}
+
+// UpstreamMessage is a message sent by a client app to the server.
+type UpstreamMessage struct {
+	MessageId string
+	// From is the registration token of the sender.
+	From string
+	// Category is the package name of the sending app.
+	Category string
+	Data     map[string]string
+}
+
+// DeliveryReceipt confirms that a downstream message was delivered to the device.
+type DeliveryReceipt struct {
+	// MessageId is the ID of the original downstream message.
+	MessageId string
+	// Token is the registration token of the device which received the message.
+	Token string
+	// Status is the delivery status, e.g. "MESSAGE_SENT_TO_DEVICE".
+	Status string
+	// SentAt is the time the message was sent to the device.
+	SentAt time.Time
+	// Category is the package name of the app which received the message.
+	Category string
+}
+
+// XmppOption customizes the XmppClient.
+type XmppOption func(*xmppOptions)
+
+type xmppOptions struct {
+	address     string
+	dialTimeout time.Duration
+	tlsConfig   *tls.Config
+	upstream    func(*UpstreamMessage)
+	receipts    func(*DeliveryReceipt)
+}
+
+// WithXmppAddress sets the host:port of the XMPP server, e.g. XmppTestAddress.
+func WithXmppAddress(address string) XmppOption {
+	return func(o *xmppOptions) {
+		o.address = address
+	}
+}
+
+// WithXmppDialTimeout sets the timeout of establishing and authenticating the connection.
+// Default is 5 seconds.
+func WithXmppDialTimeout(timeout time.Duration) XmppOption {
+	return func(o *xmppOptions) {
+		o.dialTimeout = timeout
+	}
+}
+
+// WithXmppTLSConfig sets the TLS configuration of the connection.
+func WithXmppTLSConfig(config *tls.Config) XmppOption {
+	return func(o *xmppOptions) {
+		o.tlsConfig = config
+	}
+}
+
+// WithXmppUpstreamHandler sets the function which receives upstream messages sent by client
+// apps. The handler is called on the go routine reading the connection, one message at a time.
+// The message is acknowledged to FCM after the handler returns, so a slow handler delays
+// processing of other incoming messages. Upstream messages are ACKed and dropped if no
+// handler is set.
+func WithXmppUpstreamHandler(handler func(msg *UpstreamMessage)) XmppOption {
+	return func(o *xmppOptions) {
+		o.upstream = handler
+	}
+}
+
+// WithXmppReceiptHandler sets the function which receives delivery receipts of messages sent
+// with XmppMessage.DeliveryReceiptRequested. The handler is called the same way as the
+// upstream handler, see WithXmppUpstreamHandler. Receipts are ACKed and dropped if no
+// handler is set.
+func WithXmppReceiptHandler(handler func(receipt *DeliveryReceipt)) XmppOption {
+	return func(o *xmppOptions) {
+		o.receipts = handler
+	}
+}
+
+// XmppClient sends messages over the FCM XMPP connection server (CCS). The client maintains
+// a persistent connection. When FCM announces that the connection is draining, the client
+// opens a new connection for subsequent messages while the old one receives outstanding
+// ACKs. The client is safe for concurrent use by multiple go routines.
+type XmppClient struct {
+	senderID string
+	apiKey   string
+	opts     *xmppOptions
+
+	// Prefix and counter for generating message IDs.
+	idPrefix string
+	idCount  uint64
+
+	mu sync.Mutex
+	// Connection accepting new messages, nil if a new one must be opened.
+	conn *xmppConn
+	// Open connections including the draining ones.
+	conns  map[*xmppConn]bool
+	closed bool
+}
+
+// NewXmppClient connects to FCM XMPP server and authenticates with the sender ID (project
+// number) and the server key.
+func NewXmppClient(ctx context.Context, senderID, apiKey string, opts ...XmppOption) (*XmppClient, error) {
+	o := &xmppOptions{
+		address:     XmppAddress,
+		dialTimeout: defaultConnectionTimeout,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	prefix := make([]byte, 6)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+
+	c := &XmppClient{
+		senderID: senderID,
+		apiKey:   apiKey,
+		opts:     o,
+		idPrefix: hex.EncodeToString(prefix),
+		conns:    make(map[*xmppConn]bool),
+	}
+
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	c.conns[conn] = true
+	return c, nil
+}
+
+// Send sends the message and waits for the server to ACK or NACK it. A NACK is returned
+// as *XmppError.
+func (c *XmppClient) Send(msg *XmppMessage) (*XmppResponse, error) {
+	return c.SendContext(context.Background(), msg)
+}
+
+// SendContext is the same as Send but the call is bound to the given context.
+func (c *XmppClient) SendContext(ctx context.Context, msg *XmppMessage) (*XmppResponse, error) {
+	if msg.MessageId == "" {
+		m := *msg
+		m.MessageId = c.newMessageId()
+		msg = &m
+	}
+
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		conn, err := c.connection(ctx)
+		if err != nil {
+			return nil, err
+		}
+		ack, err := conn.send(ctx, msg.MessageId, payload)
+		if err == errXmppDraining {
+			// The connection started draining before the message was written, use a new one.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ack.Error != "" {
+			return nil, &XmppError{
+				MessageId:   ack.MessageId,
+				From:        ack.From,
+				Code:        ack.Error,
+				Description: ack.ErrorDescription,
+			}
+		}
+		return &XmppResponse{
+			MessageId:      ack.MessageId,
+			From:           ack.From,
+			RegistrationId: ack.RegistrationId,
+		}, nil
+	}
+}
+
+// Close closes the connections, including the draining ones. Messages waiting for ACK fail
+// with ErrXmppClosed.
+func (c *XmppClient) Close() error {
+	c.mu.Lock()
+	conns := make([]*xmppConn, 0, len(c.conns))
+	for conn := range c.conns {
+		conns = append(conns, conn)
+	}
+	c.conn = nil
+	c.closed = true
+	c.mu.Unlock()
+
+	var err error
+	for _, conn := range conns {
+		if cerr := conn.close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// connection returns the current connection or opens a new one.
+func (c *XmppClient) connection(ctx context.Context) (*xmppConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil, ErrXmppClosed
+	}
+	if c.conn != nil && !c.conn.isDone() {
+		return c.conn, nil
+	}
+
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	c.conns[conn] = true
+	return conn, nil
+}
+
+// retire stops using the connection for new messages.
+func (c *XmppClient) retire(conn *xmppConn) {
+	c.mu.Lock()
+	if c.conn == conn {
+		c.conn = nil
+	}
+	c.mu.Unlock()
+}
+
+// forget removes the closed connection.
+func (c *XmppClient) forget(conn *xmppConn) {
+	c.mu.Lock()
+	if c.conn == conn {
+		c.conn = nil
+	}
+	delete(c.conns, conn)
+	c.mu.Unlock()
+}
+
+func (c *XmppClient) newMessageId() string {
+	return c.idPrefix + "-" + strconv.FormatUint(atomic.AddUint64(&c.idCount, 1), 10)
+}
+
+// dial opens and authenticates a new connection.
+func (c *XmppClient) dial(ctx context.Context) (*xmppConn, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.opts.dialTimeout)
+	defer cancel()
+
+	host, _, err := net.SplitHostPort(c.opts.address)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{ServerName: host}
+	if c.opts.tlsConfig != nil {
+		config = c.opts.tlsConfig.Clone()
+		if config.ServerName == "" {
+			config.ServerName = host
+		}
+	}
+
+	dialer := &tls.Dialer{Config: config}
+	raw, err := dialer.DialContext(ctx, "tcp", c.opts.address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &xmppConn{
+		client:  c,
+		raw:     raw,
+		dec:     xml.NewDecoder(raw),
+		slots:   make(chan struct{}, XmppMaxPending),
+		pending: make(map[string]chan *xmppIncoming),
+		done:    make(chan struct{}),
+	}
+
+	// Abort the handshake if the context expires.
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			raw.SetDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+	err = conn.handshake(c.senderID+"@"+xmppDomain, c.apiKey)
+	close(stop)
+	<-stopped
+	if err != nil {
+		raw.Close()
+		return nil, contextError(ctx, err)
+	}
+	raw.SetDeadline(time.Time{})
+
+	go conn.readLoop()
+	return conn, nil
+}
+
+// errXmppDraining means the connection no longer accepts new messages.
+var errXmppDraining = errors.New("fcm: xmpp connection is draining")
+
+// xmppConn is a single connection to the XMPP server.
+type xmppConn struct {
+	client *XmppClient
+	raw    net.Conn
+	dec    *xml.Decoder
+
+	// Guards writes to raw.
+	wmu sync.Mutex
+
+	// Limits the number of unacknowledged messages.
+	slots chan struct{}
+
+	mu       sync.Mutex
+	pending  map[string]chan *xmppIncoming
+	draining bool
+
+	// Closed when the connection is closed, err is the reason.
+	done chan struct{}
+	err  error
+}
+
+// xmppIncoming is the JSON payload of a message received from the server.
+type xmppIncoming struct {
+	MessageType      string `json:"message_type"`
+	MessageId        string `json:"message_id"`
+	From             string `json:"from"`
+	RegistrationId   string `json:"registration_id"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+	ControlType      string `json:"control_type"`
+
+	// Upstream message fields.
+	Category string            `json:"category"`
+	Data     map[string]string `json:"data"`
+}
+
+// XMPP stream elements.
+type xmppStreamFeatures struct {
+	Mechanisms []string  `xml:"urn:ietf:params:xml:ns:xmpp-sasl mechanisms>mechanism"`
+	Bind       *struct{} `xml:"urn:ietf:params:xml:ns:xmpp-bind bind"`
+}
+
+type xmppStanza struct {
+	XMLName xml.Name
+	Type    string `xml:"type,attr"`
+	Gcm     string `xml:"google:mobile:data gcm"`
+	Inner   []byte `xml:",innerxml"`
+}
+
+// handshake opens the stream, authenticates and binds the resource.
+func (x *xmppConn) handshake(user, password string) error {
+	features, err := x.openStream()
+	if err != nil {
+		return err
+	}
+	plain := false
+	for _, m := range features.Mechanisms {
+		if m == "PLAIN" {
+			plain = true
+		}
+	}
+	if !plain {
+		return errors.New("fcm: xmpp server does not support PLAIN authentication")
+	}
+
+	auth := base64.StdEncoding.EncodeToString([]byte("\x00" + user + "\x00" + password))
+	if err = x.write(`<auth mechanism="PLAIN" xmlns="urn:ietf:params:xml:ns:xmpp-sasl">` + auth + `</auth>`); err != nil {
+		return err
+	}
+	reply, err := x.nextElement()
+	if err != nil {
+		return err
+	}
+	if reply.XMLName.Local != "success" {
+		return errors.New("fcm: xmpp authentication failed: " + string(reply.Inner))
+	}
+
+	// Restart the stream after authentication.
+	if features, err = x.openStream(); err != nil {
+		return err
+	}
+	if features.Bind == nil {
+		return errors.New("fcm: xmpp server does not offer resource binding")
+	}
+	if err = x.write(`<iq type="set" id="bind"><bind xmlns="urn:ietf:params:xml:ns:xmpp-bind"/></iq>`); err != nil {
+		return err
+	}
+	reply, err = x.nextElement()
+	if err != nil {
+		return err
+	}
+	if reply.XMLName.Local != "iq" || reply.Type != "result" {
+		return errors.New("fcm: xmpp resource binding failed: " + string(reply.Inner))
+	}
+	return nil
+}
+
+// openStream sends the stream header and reads the server's header and features.
+func (x *xmppConn) openStream() (*xmppStreamFeatures, error) {
+	err := x.write(`<stream:stream to="` + xmppDomain + `" version="1.0" ` +
+		`xmlns="jabber:client" xmlns:stream="http://etherx.jabber.org/streams">`)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		tok, err := x.dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "stream":
+			// Header of the stream, the content follows.
+		case "features":
+			var features xmppStreamFeatures
+			if err = x.dec.DecodeElement(&features, &start); err != nil {
+				return nil, err
+			}
+			return &features, nil
+		case "error":
+			var stanza xmppStanza
+			x.dec.DecodeElement(&stanza, &start)
+			return nil, errors.New("fcm: xmpp stream error: " + string(stanza.Inner))
+		default:
+			if err = x.dec.Skip(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// nextElement reads the next top-level element of the stream.
+func (x *xmppConn) nextElement() (*xmppStanza, error) {
+	for {
+		tok, err := x.dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			var stanza xmppStanza
+			if err = x.dec.DecodeElement(&stanza, &tok); err != nil {
+				return nil, err
+			}
+			return &stanza, nil
+		case xml.EndElement:
+			// End of the stream.
+			return nil, io.EOF
+		}
+	}
+}
+
+// write sends raw XML to the server.
+func (x *xmppConn) write(data string) error {
+	x.wmu.Lock()
+	defer x.wmu.Unlock()
+	_, err := io.WriteString(x.raw, data)
+	return err
+}
+
+// writeGcm sends the JSON payload wrapped into a message stanza.
+func (x *xmppConn) writeGcm(payload []byte) error {
+	var buf bytes.Buffer
+	buf.WriteString(`<message id=""><gcm xmlns="` + xmppGcmNamespace + `">`)
+	if err := xml.EscapeText(&buf, payload); err != nil {
+		return err
+	}
+	buf.WriteString(`</gcm></message>`)
+	return x.write(buf.String())
+}
+
+// send writes the message and waits for the ACK or NACK.
+func (x *xmppConn) send(ctx context.Context, id string, payload []byte) (*xmppIncoming, error) {
+	// Wait for a free slot.
+	select {
+	case x.slots <- struct{}{}:
+	case <-x.done:
+		return nil, errXmppDraining
+	case <-ctx.Done():
+		return nil, contextError(ctx, ctx.Err())
+	}
+	defer func() { <-x.slots }()
+
+	result := make(chan *xmppIncoming, 1)
+	x.mu.Lock()
+	if x.draining {
+		x.mu.Unlock()
+		return nil, errXmppDraining
+	}
+	x.pending[id] = result
+	x.mu.Unlock()
+
+	if err := x.writeGcm(payload); err != nil {
+		x.unregister(id)
+		x.fail(err)
+		return nil, err
+	}
+
+	select {
+	case ack := <-result:
+		return ack, nil
+	case <-x.done:
+		// The ACK may have arrived just before the connection was closed.
+		select {
+		case ack := <-result:
+			return ack, nil
+		default:
+		}
+		return nil, ErrXmppClosed
+	case <-ctx.Done():
+		x.unregister(id)
+		return nil, contextError(ctx, ctx.Err())
+	}
+}
+
+func (x *xmppConn) unregister(id string) {
+	x.mu.Lock()
+	delete(x.pending, id)
+	x.mu.Unlock()
+}
+
+// readLoop reads messages from the server until the connection is closed.
+func (x *xmppConn) readLoop() {
+	for {
+		stanza, err := x.nextElement()
+		if err != nil {
+			x.fail(err)
+			return
+		}
+
+		switch stanza.XMLName.Local {
+		case "message":
+			if stanza.Gcm == "" {
+				continue
+			}
+			var msg xmppIncoming
+			if err = json.Unmarshal([]byte(stanza.Gcm), &msg); err != nil {
+				continue
+			}
+			x.handle(&msg)
+		case "error":
+			x.fail(errors.New("fcm: xmpp stream error: " + string(stanza.Inner)))
+			return
+		}
+	}
+}
+
+// handle dispatches a message received from the server.
+func (x *xmppConn) handle(msg *xmppIncoming) {
+	switch msg.MessageType {
+	case xmppMessageAck, xmppMessageNack:
+		x.mu.Lock()
+		result := x.pending[msg.MessageId]
+		delete(x.pending, msg.MessageId)
+		x.mu.Unlock()
+		if result != nil {
+			result <- msg
+		}
+	case xmppMessageControl:
+		if msg.ControlType == xmppControlDraining {
+			// FCM will close the connection soon. Outstanding messages still get ACKs.
+			x.mu.Lock()
+			x.draining = true
+			x.mu.Unlock()
+			x.client.retire(x)
+		}
+	case "":
+		// Upstream message from a client app.
+		if handler := x.client.opts.upstream; handler != nil {
+			handler(&UpstreamMessage{
+				MessageId: msg.MessageId,
+				From:      msg.From,
+				Category:  msg.Category,
+				Data:      msg.Data,
+			})
+		}
+		x.ack(msg)
+	case xmppMessageReceipt:
+		if handler := x.client.opts.receipts; handler != nil {
+			receipt := &DeliveryReceipt{
+				MessageId: msg.Data["original_message_id"],
+				Token:     msg.Data["device_registration_id"],
+				Status:    msg.Data["message_status"],
+				Category:  msg.Category,
+			}
+			if ms, err := strconv.ParseInt(msg.Data["message_sent_timestamp"], 10, 64); err == nil {
+				receipt.SentAt = time.Unix(0, ms*int64(time.Millisecond))
+			}
+			handler(receipt)
+		}
+		x.ack(msg)
+	}
+}
+
+// ack acknowledges the message received from FCM. Otherwise FCM delivers it again.
+func (x *xmppConn) ack(msg *xmppIncoming) {
+	payload, err := json.Marshal(map[string]string{
+		"to":           msg.From,
+		"message_id":   msg.MessageId,
+		"message_type": xmppMessageAck,
+	})
+	if err != nil {
+		return
+	}
+	if err = x.writeGcm(payload); err != nil {
+		x.fail(err)
+	}
+}
+
+// isDone checks if the connection is closed or draining.
+func (x *xmppConn) isDone() bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.draining || x.err != nil
+}
+
+// fail closes the connection with the given reason.
+func (x *xmppConn) fail(err error) {
+	x.mu.Lock()
+	if x.err != nil {
+		x.mu.Unlock()
+		return
+	}
+	x.err = err
+	x.draining = true
+	x.mu.Unlock()
+
+	x.raw.Close()
+	close(x.done)
+	x.client.forget(x)
+}
+
+// close ends the stream and closes the connection.
+func (x *xmppConn) close() error {
+	err := x.write(`</stream:stream>`)
+	x.fail(ErrXmppClosed)
+	return err
+}